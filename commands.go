@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// cacheCommand holds the cache subcommands
+type cacheCommand struct {
+	Stats struct{} `command:"stats" description:"show cache statistics"`
+	Purge struct {
+		All bool `short:"a" long:"all" description:"remove all cached responses, not only expired ones"`
+	} `command:"purge" description:"remove expired cached responses"`
+}
+
+// configCommand holds the config subcommands
+type configCommand struct {
+	Show struct{} `command:"show" description:"show effective values of options and where they are taken from"`
+}
+
+// runCommand runs the subcommand specified in the command line
+func runCommand(opts options) error {
+	switch opts.command {
+	case "cache stats":
+		return showCacheStats(opts)
+	case "cache purge":
+		return purgeCache(opts)
+	case "config show":
+		return showConfig(os.Stdout, opts)
+	case "serve":
+		done := make(chan struct{})
+		go handleExitSignal(done)
+		return serve(opts, done)
+	case "history list", "history search", "history delete", "history export":
+		return runHistoryCommand(os.Stdout, opts, time.Now())
+	}
+	return errors.Errorf("unknown command %s", opts.command)
+}
+
+// showCacheStats prints the cache statistics to the terminal
+func showCacheStats(opts options) error {
+	c, err := lookup.NewCache(opts.CacheDir, opts.CacheTTL, opts.CacheMaxSize<<20)
+	if err != nil {
+		return err
+	}
+	st, err := c.Stats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cache directory: %s\n", opts.CacheDir)
+	fmt.Printf("Entries: %d (%d expired)\n", st.Entries, st.Expired)
+	if opts.CacheMaxSize > 0 {
+		fmt.Printf("Size: %.2f MB of %d MB\n", float64(st.Size)/(1<<20), opts.CacheMaxSize)
+	} else {
+		fmt.Printf("Size: %.2f MB\n", float64(st.Size)/(1<<20))
+	}
+	if st.Entries > 0 {
+		fmt.Printf("Oldest entry: %s\n", st.Oldest.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Newest entry: %s\n", st.Newest.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// purgeCache removes expired or all cached responses
+func purgeCache(opts options) error {
+	c, err := lookup.NewCache(opts.CacheDir, opts.CacheTTL, opts.CacheMaxSize<<20)
+	if err != nil {
+		return err
+	}
+	n, err := c.Purge(opts.Cache.Purge.All)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d cached responses\n", n)
+	return nil
+}
+
+// showConfig prints the config file, the profile and effective values of options
+func showConfig(w io.Writer, opts options) error {
+	if opts.config == nil || opts.config.file == "" {
+		fmt.Fprintf(w, "Config file: none (%s doesn't exist)\n", defaultConfigFile())
+	} else {
+		fmt.Fprintf(w, "Config file: %s\n", opts.config.file)
+	}
+	if opts.config != nil && opts.config.profile != "" {
+		fmt.Fprintf(w, "Profile: %s\n", opts.config.profile)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range opts.settings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.name, s.value, s.source)
+	}
+	return tw.Flush()
+}
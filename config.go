@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/pkg/errors"
+)
+
+// profilePrefix starts names of config file sections holding named profiles, e.g. [profile.german]
+const profilePrefix = "profile."
+
+// config holds information about the config file used
+type config struct {
+	file    string
+	profile string
+	// values holds long names of options whose values are taken from the config file
+	values map[string]bool
+}
+
+// setting holds the effective value of the option and where it is taken from
+type setting struct {
+	name   string
+	value  string
+	source string
+}
+
+// defaultConfigFile returns the config file used if it isn't specified explicitly
+func defaultConfigFile() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "lu", "config.ini")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "lu", "config.ini")
+}
+
+// loadConfig reads the config file and makes its values defaults of the parser options,
+// so flags and environment variables take precedence over them.
+// The config file and the profile are taken from the command line arguments or environment variables.
+// Options of the profile override the ones from the global section
+func loadConfig(parser *flags.Parser, args []string) (*config, error) {
+	var pre struct {
+		File    string `long:"config" env:"LU_CONFIG"`
+		Profile string `long:"profile" env:"LU_PROFILE"`
+	}
+	_, err := flags.NewParser(&pre, flags.IgnoreUnknown|flags.PassDoubleDash).ParseArgs(args)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not parse arguments")
+	}
+
+	cfg := &config{file: pre.File, profile: pre.Profile, values: make(map[string]bool)}
+	if cfg.file == "" {
+		cfg.file = defaultConfigFile()
+	}
+
+	data, err := ioutil.ReadFile(cfg.file)
+	if err != nil {
+		// only the explicitly specified config file must exist
+		if os.IsNotExist(err) && pre.File == "" {
+			if cfg.profile != "" {
+				return nil, errors.Errorf("can't use profile %s, there is no config file %s", cfg.profile, cfg.file)
+			}
+			cfg.file = ""
+			return cfg, nil
+		}
+		return nil, errors.Wrap(err, "can't read config file")
+	}
+
+	global, profiles := splitConfig(data)
+	sections := []string{global}
+	if cfg.profile != "" {
+		profile, ok := profiles[cfg.profile]
+		if !ok {
+			return nil, errors.Errorf("there is no profile %s in config file %s", cfg.profile, cfg.file)
+		}
+		sections = append(sections, profile)
+	}
+
+	for _, section := range sections {
+		values, err := parseConfigSection(section, cfg.file)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range values {
+			parser.FindOptionByLongName(name).Default = value
+			cfg.values[name] = true
+		}
+	}
+	return cfg, nil
+}
+
+// splitConfig splits the config file into the global part and named profiles.
+// Lines of other parts are replaced with empty ones, so line numbers in errors stay correct
+func splitConfig(data []byte) (string, map[string]string) {
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	// owners holds profile names for each line, the global part has the empty name,
+	// "\x00" marks profile headers, which belong to no part
+	owners := make([]string, len(lines))
+	profile := ""
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if strings.HasPrefix(name, profilePrefix) {
+				profile = strings.TrimPrefix(name, profilePrefix)
+				// header of the profile is not needed, its options are parsed as global ones
+				owners[i] = "\x00"
+				continue
+			}
+			profile = ""
+		}
+		owners[i] = profile
+	}
+
+	part := func(owner string) string {
+		out := make([]string, len(lines))
+		for i, line := range lines {
+			if owners[i] == owner {
+				out[i] = line
+			}
+		}
+		return strings.Join(out, "\n")
+	}
+
+	profiles := make(map[string]string)
+	for _, owner := range owners {
+		if _, ok := profiles[owner]; !ok && owner != "" && owner != "\x00" {
+			profiles[owner] = part(owner)
+		}
+	}
+	return part(""), profiles
+}
+
+// parseConfigSection parses the part of the config file using go-flags INI parser,
+// which checks option names and values, and returns string values of options set in it
+func parseConfigSection(text, fname string) (map[string][]string, error) {
+	var opts options
+	parser := flags.NewParser(&opts, flags.None)
+	err := flags.NewIniParser(parser).Parse(strings.NewReader(text))
+	if err != nil {
+		if iniErr, ok := err.(*flags.IniError); ok {
+			iniErr.File = fname
+		}
+		return nil, errors.Wrap(err, "can't parse config file")
+	}
+
+	values := make(map[string][]string)
+	for _, opt := range parserOptions(parser) {
+		if opt.IsSet() && opt.LongName != "" {
+			values[opt.LongName] = optionStrings(opt.Value())
+		}
+	}
+	return values, nil
+}
+
+// parserOptions returns application options of the parser, without options of subcommands
+func parserOptions(parser *flags.Parser) []*flags.Option {
+	var opts []*flags.Option
+	for _, g := range parser.Groups() {
+		opts = append(opts, g.Options()...)
+	}
+	return opts
+}
+
+// optionStrings converts the option value back to strings
+func optionStrings(value interface{}) []string {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return []string{fmt.Sprint(value)}
+	}
+	strs := make([]string, v.Len())
+	for i := range strs {
+		strs[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strs
+}
+
+// effectiveSettings returns values of options after parsing along with their sources:
+// the command line flag, the environment variable, the config file or the default value.
+// Values of API keys are masked
+func effectiveSettings(parser *flags.Parser, cfg *config) []*setting {
+	var settings []*setting
+	for _, opt := range parserOptions(parser) {
+		// skip the help flag, which is the function, and options which can't be set in the config file
+		if opt.LongName == "" || opt.Field().Tag.Get("no-ini") != "" || opt.Field().Type.Kind() == reflect.Func {
+			continue
+		}
+
+		s := &setting{name: opt.LongName, value: strings.Join(optionStrings(opt.Value()), ", ")}
+		if _, ok := os.LookupEnv(opt.EnvDefaultKey); opt.EnvDefaultKey != "" && ok {
+			s.source = "environment variable " + opt.EnvDefaultKey
+		}
+		switch {
+		case opt.IsSet() && !opt.IsSetDefault():
+			s.source = "flag"
+		case s.source != "":
+		case cfg != nil && cfg.values[opt.LongName]:
+			s.source = "config file"
+		default:
+			s.source = "default"
+		}
+
+		if strings.HasSuffix(opt.LongName, "-key") && s.value != "" {
+			s.value = maskKey(s.value)
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// setByFlag returns true if the option with the long name is set by the command line flag
+func (opts *options) setByFlag(name string) bool {
+	for _, s := range opts.settings {
+		if s.name == name {
+			return s.source == "flag"
+		}
+	}
+	return false
+}
+
+// maskKey hides the API key, leaving last characters for identification
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
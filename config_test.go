@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `; global options
+from = en
+to = de
+format = html
+cache-ttl = 48h
+yandex-dictionary-key = dict-key-1234567
+
+[profile.italian]
+to = it
+to = fr
+provider = libretranslate
+
+[profile.german]
+from = fr
+`
+
+// withConfig writes the config file to the temporary directory and calls fn with its name
+func withConfig(t *testing.T, text string, fn func(fname string)) {
+	dir, err := ioutil.TempDir("", "lu")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "config.ini")
+	require.NoError(t, ioutil.WriteFile(fname, []byte(text), 0600))
+	fn(fname)
+}
+
+func Test_splitConfig(t *testing.T) {
+	global, profiles := splitConfig([]byte(testConfig))
+	assert.Contains(t, global, "format = html")
+	assert.NotContains(t, global, "provider")
+	require.Len(t, profiles, 2)
+	assert.Contains(t, profiles["italian"], "to = it")
+	assert.NotContains(t, profiles["italian"], "from")
+	assert.NotContains(t, profiles["italian"], "[profile.italian]")
+	assert.Contains(t, profiles["german"], "from = fr")
+
+	// line numbers are kept
+	assert.Equal(t, bytes.Count([]byte(testConfig), []byte("\n"))-1, bytes.Count([]byte(profiles["german"]), []byte("\n")))
+}
+
+func Test_parseCommandLine_config(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	withConfig(t, testConfig, func(fname string) {
+		os.Args = []string{"lu", "--config", fname}
+		_, opts, err := parseCommandLine()
+		require.NoError(t, err)
+		assert.Equal(t, "en", opts.FromLang)
+		assert.Equal(t, []string{"de"}, opts.ToLangs)
+		assert.Equal(t, "html", opts.Format)
+		assert.Equal(t, "48h0m0s", opts.CacheTTL.String())
+		assert.Equal(t, "dict-key-1234567", opts.YandexDictKey)
+		assert.Equal(t, "yandex", opts.Provider)
+		assert.Equal(t, fname, opts.config.file)
+
+		// profile options override global ones
+		os.Args = []string{"lu", "--config", fname, "--profile", "italian"}
+		_, opts, err = parseCommandLine()
+		require.NoError(t, err)
+		assert.Equal(t, "en", opts.FromLang)
+		assert.Equal(t, []string{"it", "fr"}, opts.ToLangs)
+		assert.Equal(t, "libretranslate", opts.Provider)
+
+		// environment variables override the config file and flags override both
+		os.Setenv("LU_DEFAULT_FROM_LANG", "es")
+		os.Setenv("LU_PROFILE", "german")
+		defer os.Unsetenv("LU_DEFAULT_FROM_LANG")
+		defer os.Unsetenv("LU_PROFILE")
+		os.Args = []string{"lu", "--config", fname, "-tru"}
+		_, opts, err = parseCommandLine()
+		require.NoError(t, err)
+		assert.Equal(t, "es", opts.FromLang)
+		assert.Equal(t, []string{"ru"}, opts.ToLangs)
+		assert.Equal(t, "german", opts.config.profile)
+
+		sources := make(map[string]string)
+		values := make(map[string]string)
+		for _, s := range opts.settings {
+			sources[s.name], values[s.name] = s.source, s.value
+		}
+		assert.Equal(t, "environment variable LU_DEFAULT_FROM_LANG", sources["from"])
+		assert.Equal(t, "flag", sources["to"])
+		assert.Equal(t, "config file", sources["format"])
+		assert.Equal(t, "default", sources["jobs"])
+		assert.Equal(t, "****4567", values["yandex-dictionary-key"])
+		assert.NotContains(t, sources, "version")
+		assert.NotContains(t, sources, "config")
+		assert.True(t, opts.setByFlag("to"))
+		assert.False(t, opts.setByFlag("from"))
+		assert.False(t, opts.setByFlag("nonexistent"))
+
+		os.Args = []string{"lu", "--config", fname, "--profile", "spanish"}
+		_, _, err = parseCommandLine()
+		assert.EqualError(t, err, "there is no profile spanish in config file "+fname)
+	})
+
+	os.Args = []string{"lu", "--config", "/nonexistent/config.ini", "-fen", "-tde"}
+	_, _, err := parseCommandLine()
+	assert.Error(t, err)
+
+	os.Args = []string{"lu", "--profile", "german", "-fen", "-tde"}
+	_, _, err = parseCommandLine()
+	assert.EqualError(t, err, "can't use profile german, there is no config file "+defaultConfigFile())
+
+	withConfig(t, "from = en\nlanguage = de\n", func(fname string) {
+		os.Args = []string{"lu", "--config", fname}
+		_, _, err = parseCommandLine()
+		assert.EqualError(t, err, "can't parse config file: "+fname+":2: unknown option: language")
+	})
+
+	withConfig(t, "[profile.german]\nformat = pdf\n", func(fname string) {
+		os.Args = []string{"lu", "--config", fname, "--profile", "german", "-fen", "-tde"}
+		_, _, err = parseCommandLine()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fname+":2:")
+	})
+}
+
+func Test_optionStrings(t *testing.T) {
+	assert.Equal(t, []string{"en"}, optionStrings("en"))
+	assert.Equal(t, []string{"4"}, optionStrings(4))
+	assert.Equal(t, []string{"true"}, optionStrings(true))
+	assert.Equal(t, []string{"de", "it"}, optionStrings([]string{"de", "it"}))
+	assert.Equal(t, []string{}, optionStrings([]string{}))
+}
+
+func Test_maskKey(t *testing.T) {
+	assert.Equal(t, "****", maskKey("short"))
+	assert.Equal(t, "****cdef", maskKey("0123456789abcdef"))
+}
+
+func Test_defaultConfigFile(t *testing.T) {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	defer os.Setenv("XDG_CONFIG_HOME", xdg)
+
+	os.Setenv("XDG_CONFIG_HOME", "/config")
+	assert.Equal(t, filepath.Join("/config", "lu", "config.ini"), defaultConfigFile())
+	os.Setenv("XDG_CONFIG_HOME", "")
+	assert.Equal(t, filepath.Join(os.Getenv("HOME"), ".config", "lu", "config.ini"), defaultConfigFile())
+}
+
+func Test_showConfig(t *testing.T) {
+	var b bytes.Buffer
+	opts := options{
+		config:   &config{file: "/config.ini", profile: "german"},
+		settings: []*setting{{name: "from", value: "en", source: "config file"}, {name: "jobs", value: "4", source: "default"}},
+	}
+	require.NoError(t, showConfig(&b, opts))
+	assert.Equal(t, "Config file: /config.ini\nProfile: german\n\nfrom  en  config file\njobs  4   default\n", b.String())
+
+	b.Reset()
+	require.NoError(t, showConfig(&b, options{}))
+	assert.Contains(t, b.String(), "Config file: none")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/dafanasev/lu/lookup"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeRequest returns the form of the request used to find its repetitions:
+// NFC normalized, lowercased, with whitespace collapsed to single spaces
+func normalizeRequest(req string) string {
+	return norm.NFC.String(strings.ToLower(strings.Join(strings.Fields(req), " ")))
+}
+
+// occurrence holds how many times the request occurs in the data source and the line of the last occurrence
+type occurrence struct {
+	count int
+	last  int
+}
+
+// occurrences counts repeated requests of the data source, so each of them is looked up only once.
+// It is safe for concurrent use
+type occurrences struct {
+	mu sync.Mutex
+	m  map[string]*occurrence
+	// from is the language to translate from used for requests which have no language set in the data source
+	from string
+}
+
+// newOccurrences creates the empty occurrences counter
+func newOccurrences(from string) *occurrences {
+	return &occurrences{m: make(map[string]*occurrence), from: from}
+}
+
+// key returns the key of the request, requests with different languages are different ones
+func (o *occurrences) key(req, from string) string {
+	if from == "" {
+		from = o.from
+	}
+	return from + "\x00" + normalizeRequest(req)
+}
+
+// add counts the occurrence of the request at the line and returns true if it is the first one.
+// From is the language set for the request in the data source, if any
+func (o *occurrences) add(req, from string, line int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	key := o.key(req, from)
+	occ, ok := o.m[key]
+	if !ok {
+		occ = &occurrence{}
+		o.m[key] = occ
+	}
+	occ.count++
+	occ.last = line
+	return !ok
+}
+
+// apply sets occurrence counts and last lines of entries
+func (o *occurrences) apply(entries []*lookup.Entry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, e := range entries {
+		// the detected language isn't known when requests are counted
+		from := e.From
+		if e.Detected {
+			from = ""
+		}
+		if occ, ok := o.m[o.key(e.Request, from)]; ok {
+			e.Count, e.LastLine = occ.count, occ.last
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_normalizeRequest(t *testing.T) {
+	assert.Equal(t, "black dog", normalizeRequest("  Black \t DOG "))
+	// decomposed é is composed
+	assert.Equal(t, "caf\u00e9", normalizeRequest("Cafe\u0301"))
+}
+
+func Test_occurrences(t *testing.T) {
+	o := newOccurrences("auto")
+	assert.True(t, o.add("Dog", "", 1))
+	assert.True(t, o.add("black dog", "", 2))
+	assert.False(t, o.add("dog ", "", 3))
+	assert.False(t, o.add("DOG", "", 5))
+	// the request with the other language is the different one
+	assert.True(t, o.add("dog", "de", 6))
+
+	entries := []*lookup.Entry{
+		{Request: "Dog", From: "en", Detected: true, Line: 1},
+		{Request: "black dog", Line: 2},
+		{Request: "dog", From: "de", Line: 6},
+		{Request: "cat", Line: 7},
+	}
+	o.apply(entries)
+	assert.Equal(t, 3, entries[0].Count)
+	assert.Equal(t, 5, entries[0].LastLine)
+	assert.Equal(t, 1, entries[1].Count)
+	assert.Equal(t, 2, entries[1].LastLine)
+	assert.Equal(t, 1, entries[2].Count)
+	assert.Equal(t, 0, entries[3].Count)
+}
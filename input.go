@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// source file formats
+const (
+	inputText  = "text"
+	inputCSV   = "csv"
+	inputTSV   = "tsv"
+	inputJSON  = "json"
+	inputJSONL = "jsonl"
+)
+
+// requestKey is the default key of JSON objects holding requests
+const requestKey = "request"
+
+// fromField is the name of the column or the key of JSON objects holding the language of the request
+const fromField = "from"
+
+// overrideRe matches the request prefixed with the language to translate from in brackets, e.g. [de] Hund,
+// which can't be mistaken for the text, unlike de: Hund
+var overrideRe = regexp.MustCompile(`^\[([a-z]{2,3})\]\s*(\S.*)$`)
+
+// record is the unit of the data source: the line of the text, the row of CSV or the JSON value
+type record struct {
+	text string
+	// line is the line number of the text, CSV or JSON Lines file, or the number of the JSON array element
+	line int
+	// from is the language to translate from set for the record
+	from string
+	// prefixed holds the text as is, if the language is set by its prefix
+	prefixed string
+	// meta holds other columns of CSV rows or fields of JSON objects
+	meta map[string]string
+}
+
+// inputReader reads records of the data source
+type inputReader interface {
+	// read returns the next record or io.EOF at the end of the data source
+	read() (*record, error)
+}
+
+// inputFormat returns the source file format, taken from the option or from the file extension
+func inputFormat(format, fname string) string {
+	if format != "" {
+		return format
+	}
+	switch ext := strings.TrimPrefix(filepath.Ext(fname), "."); ext {
+	case inputCSV, inputTSV, inputJSON, inputJSONL:
+		return ext
+	}
+	return inputText
+}
+
+// newInputReader creates the reader of the data source in the format.
+// Column is the name or the number, starting from 1, of CSV column or the key of JSON objects holding requests.
+// Annotated turns on comments and language overrides of text lines, they are supported in source files only,
+// so requests from command line arguments and stdin are looked up as is
+func newInputReader(r io.Reader, format, column string, noHeader, annotated bool) (inputReader, error) {
+	switch format {
+	case "", inputText:
+		return newTextReader(r, annotated), nil
+	case inputCSV, inputTSV:
+		cr := csv.NewReader(r)
+		if format == inputTSV {
+			cr.Comma = '\t'
+			cr.LazyQuotes = true
+		}
+		cr.Comment = '#'
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		return &csvReader{r: cr, column: column, header: !noHeader, fromIdx: -1}, nil
+	case inputJSON, inputJSONL:
+		if column == "" {
+			column = requestKey
+		}
+		if format == inputJSONL {
+			return &jsonlReader{scanner: bufio.NewScanner(r), key: column}, nil
+		}
+		return &jsonReader{dec: json.NewDecoder(r), key: column}, nil
+	}
+	return nil, errors.Errorf("unknown source file format %s", format)
+}
+
+// isComment returns true if the line is the comment, which starts with #
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
+
+// setText sets the request of the record, taking the language from its prefix, e.g. [de] Hund
+func (rec *record) setText(text string) {
+	rec.text = text
+	if m := overrideRe.FindStringSubmatch(strings.TrimSpace(text)); m != nil {
+		rec.text, rec.from, rec.prefixed = m[2], m[1], text
+	}
+}
+
+// textReader reads lines of the text, the annotated one can have comments and language overrides
+type textReader struct {
+	scanner   *bufio.Scanner
+	line      int
+	annotated bool
+}
+
+// newTextReader creates the text reader
+func newTextReader(r io.Reader, annotated bool) *textReader {
+	return &textReader{scanner: bufio.NewScanner(r), annotated: annotated}
+}
+
+func (r *textReader) read() (*record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		rec := &record{text: r.scanner.Text(), line: r.line}
+		if r.annotated {
+			if isComment(rec.text) {
+				continue
+			}
+			rec.setText(rec.text)
+		}
+		return rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't read source")
+	}
+	return nil, io.EOF
+}
+
+// csvReader reads rows of CSV or TSV file, the first row holds column names unless the header is turned off
+type csvReader struct {
+	r      *csv.Reader
+	column string
+	header bool
+	names  []string
+	// idx and fromIdx are indexes of columns holding requests and languages, fromIdx is -1 if there is no such column
+	idx     int
+	fromIdx int
+	started bool
+}
+
+func (r *csvReader) read() (*record, error) {
+	if !r.started {
+		r.started = true
+		if err := r.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	row, err := r.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read source file")
+	}
+
+	rec := &record{}
+	rec.line, _ = r.r.FieldPos(0)
+	if r.idx < len(row) {
+		rec.setText(row[r.idx])
+	}
+	if r.fromIdx != -1 && r.fromIdx < len(row) && row[r.fromIdx] != "" {
+		rec.from = row[r.fromIdx]
+	}
+	for i, v := range row {
+		if i == r.idx || i == r.fromIdx || v == "" {
+			continue
+		}
+		if rec.meta == nil {
+			rec.meta = make(map[string]string)
+		}
+		name := strconv.Itoa(i + 1)
+		if i < len(r.names) && r.names[i] != "" {
+			name = r.names[i]
+		}
+		rec.meta[name] = v
+	}
+	return rec, nil
+}
+
+// start reads the header and finds the column holding requests
+func (r *csvReader) start() error {
+	if r.header {
+		names, err := r.r.Read()
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "can't read source file")
+		}
+		for i, name := range names {
+			names[i] = strings.TrimSpace(name)
+			if names[i] == fromField {
+				r.fromIdx = i
+			}
+		}
+		r.names = names
+	}
+
+	if r.column == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(r.column); err == nil {
+		if n < 1 {
+			return errors.Errorf("wrong column number %d, columns are numbered from 1", n)
+		}
+		r.idx = n - 1
+		return nil
+	}
+	for i, name := range r.names {
+		if name == r.column {
+			r.idx = i
+			return nil
+		}
+	}
+	return errors.Errorf("there is no column %s in the source file", r.column)
+}
+
+// jsonReader reads elements of JSON array, which are either requests or objects holding them
+type jsonReader struct {
+	dec     *json.Decoder
+	key     string
+	n       int
+	started bool
+}
+
+func (r *jsonReader) read() (*record, error) {
+	if !r.started {
+		r.started = true
+		tok, err := r.dec.Token()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil || tok != json.Delim('[') {
+			return nil, errors.New("can't read source file, it must hold JSON array")
+		}
+	}
+	if !r.dec.More() {
+		return nil, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := r.dec.Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "can't read source file")
+	}
+	r.n++
+	return decodeRecord(raw, r.key, r.n)
+}
+
+// jsonlReader reads JSON Lines, skipping empty lines and comments
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	key     string
+	line    int
+}
+
+func (r *jsonlReader) read() (*record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		return decodeRecord(line, r.key, r.line)
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't read source file")
+	}
+	return nil, io.EOF
+}
+
+// decodeRecord decodes the JSON value, which is either the request or the object holding it by the key.
+// Other fields of the object become metadata, non string values are kept as JSON
+func decodeRecord(data []byte, key string, line int) (*record, error) {
+	rec := &record{line: line}
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		rec.setText(text)
+		return rec, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Errorf("can't read source file, record %d must be string or object", line)
+	}
+	raw, ok := fields[key]
+	if !ok {
+		return nil, errors.Errorf("can't read source file, record %d has no %s key", line, key)
+	}
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return nil, errors.Errorf("can't read source file, %s of record %d must be string", key, line)
+	}
+	rec.setText(text)
+
+	for k, v := range fields {
+		if k == key {
+			continue
+		}
+		var s string
+		if json.Unmarshal(v, &s) != nil {
+			s = string(v)
+		}
+		if s == "" {
+			continue
+		}
+		if k == fromField {
+			rec.from = s
+			continue
+		}
+		if rec.meta == nil {
+			rec.meta = make(map[string]string)
+		}
+		rec.meta[k] = s
+	}
+	return rec, nil
+}
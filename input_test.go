@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readRecords reads all records of the data source
+func readRecords(t *testing.T, r inputReader) []*record {
+	var recs []*record
+	for {
+		rec, err := r.read()
+		if err == io.EOF {
+			return recs
+		}
+		require.NoError(t, err)
+		recs = append(recs, rec)
+	}
+}
+
+func Test_inputFormat(t *testing.T) {
+	assert.Equal(t, "csv", inputFormat("", "words.csv"))
+	assert.Equal(t, "jsonl", inputFormat("", "words.jsonl"))
+	assert.Equal(t, "text", inputFormat("", "words.txt"))
+	assert.Equal(t, "text", inputFormat("", ""))
+	assert.Equal(t, "tsv", inputFormat("tsv", "words.csv"))
+}
+
+func Test_record_setText(t *testing.T) {
+	rec := &record{}
+	rec.setText(" [de] Hund ")
+	assert.Equal(t, &record{text: "Hund", from: "de", prefixed: " [de] Hund "}, rec)
+
+	// colons are the part of the text
+	for _, s := range []string{"dog", "Note: dog", "see: also", "it: is", "de: Hund", "http://example.com", "[Hund]", "[de]"} {
+		rec = &record{}
+		rec.setText(s)
+		assert.Equal(t, &record{text: s}, rec)
+	}
+}
+
+func Test_textReader(t *testing.T) {
+	recs := readRecords(t, newTextReader(strings.NewReader("dog\n# animals\n  #\n\n[de] Hund\nsee: also\n"), true))
+	assert.Equal(t, []*record{
+		{text: "dog", line: 1},
+		{text: "", line: 4},
+		{text: "Hund", line: 5, from: "de", prefixed: "[de] Hund"},
+		{text: "see: also", line: 6},
+	}, recs)
+
+	// lines of not annotated text are requests as is
+	recs = readRecords(t, newTextReader(strings.NewReader("#tag\n[de] Hund\n"), false))
+	assert.Equal(t, []*record{{text: "#tag", line: 1}, {text: "[de] Hund", line: 2}}, recs)
+}
+
+func Test_csvReader(t *testing.T) {
+	s := "word,from,note,chapter\n# comment\ndog,,pet,1\nHund,de,,2\n\"black, dog\"\n"
+	r, err := newInputReader(strings.NewReader(s), inputCSV, "", false, false)
+	require.NoError(t, err)
+	recs := readRecords(t, r)
+	require.Len(t, recs, 3)
+	assert.Equal(t, &record{text: "dog", line: 3, meta: map[string]string{"note": "pet", "chapter": "1"}}, recs[0])
+	assert.Equal(t, &record{text: "Hund", line: 4, from: "de", meta: map[string]string{"chapter": "2"}}, recs[1])
+	assert.Equal(t, &record{text: "black, dog", line: 5}, recs[2])
+
+	r, err = newInputReader(strings.NewReader(s), inputCSV, "note", false, false)
+	require.NoError(t, err)
+	recs = readRecords(t, r)
+	assert.Equal(t, "pet", recs[0].text)
+	assert.Equal(t, map[string]string{"word": "dog", "chapter": "1"}, recs[0].meta)
+
+	r, err = newInputReader(strings.NewReader("1\tdog\tpet\n2\t[fr] chien\n"), inputTSV, "2", true, false)
+	require.NoError(t, err)
+	recs = readRecords(t, r)
+	assert.Equal(t, []*record{
+		{text: "dog", line: 1, meta: map[string]string{"1": "1", "3": "pet"}},
+		{text: "chien", line: 2, from: "fr", prefixed: "[fr] chien", meta: map[string]string{"1": "2"}},
+	}, recs)
+
+	r, err = newInputReader(strings.NewReader(s), inputCSV, "words", false, false)
+	require.NoError(t, err)
+	_, err = r.read()
+	assert.EqualError(t, err, "there is no column words in the source file")
+
+	r, err = newInputReader(strings.NewReader(s), inputCSV, "0", false, false)
+	require.NoError(t, err)
+	_, err = r.read()
+	assert.EqualError(t, err, "wrong column number 0, columns are numbered from 1")
+}
+
+func Test_jsonReader(t *testing.T) {
+	s := `["dog", {"request": "Hund", "from": "de", "tags": ["pet"], "chapter": 2}, {"request": "cat", "note": ""}]`
+	r, err := newInputReader(strings.NewReader(s), inputJSON, "", false, false)
+	require.NoError(t, err)
+	recs := readRecords(t, r)
+	assert.Equal(t, []*record{
+		{text: "dog", line: 1},
+		{text: "Hund", line: 2, from: "de", meta: map[string]string{"tags": `["pet"]`, "chapter": "2"}},
+		{text: "cat", line: 3},
+	}, recs)
+
+	r, err = newInputReader(strings.NewReader(`{"request": "dog"}`), inputJSON, "", false, false)
+	require.NoError(t, err)
+	_, err = r.read()
+	assert.EqualError(t, err, "can't read source file, it must hold JSON array")
+
+	r, err = newInputReader(strings.NewReader(`[{"word": "dog"}]`), inputJSON, "", false, false)
+	require.NoError(t, err)
+	_, err = r.read()
+	assert.EqualError(t, err, "can't read source file, record 1 has no request key")
+
+	r, err = newInputReader(strings.NewReader(`[1]`), inputJSON, "", false, false)
+	require.NoError(t, err)
+	_, err = r.read()
+	assert.EqualError(t, err, "can't read source file, record 1 must be string or object")
+}
+
+func Test_jsonlReader(t *testing.T) {
+	s := "{\"word\": \"dog\", \"note\": \"pet\"}\n\n# comment\n\"[de] Hund\"\n"
+	r, err := newInputReader(strings.NewReader(s), inputJSONL, "word", false, false)
+	require.NoError(t, err)
+	recs := readRecords(t, r)
+	assert.Equal(t, []*record{
+		{text: "dog", line: 1, meta: map[string]string{"note": "pet"}},
+		{text: "Hund", line: 4, from: "de", prefixed: "[de] Hund"},
+	}, recs)
+
+	r, err = newInputReader(strings.NewReader("{\"word\": 1}\n"), inputJSONL, "word", false, false)
+	require.NoError(t, err)
+	_, err = r.read()
+	assert.EqualError(t, err, "can't read source file, word of record 1 must be string")
+}
@@ -0,0 +1,85 @@
+// Package mock provides the lookup provider which knows only a few requests, e.g. dog for en-de,
+// it is used for tests and debug purposes
+package mock
+
+import (
+	"context"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// New creates the mock provider
+func New() *lookup.Provider {
+	return &lookup.Provider{
+		Name:       "mock",
+		Dictionary: &dictionary{},
+		Translator: &translator{},
+	}
+}
+
+// dictionary is the mock of the dictionary, it knows only dog for en-de
+type dictionary struct{}
+
+func (d *dictionary) Lookup(ctx context.Context, params *lookup.Params) ([]*lookup.Definition, error) {
+	if params.Text != "dog" || params.From != "en" || params.To != "de" {
+		return nil, errors.New("no entry")
+	}
+	return []*lookup.Definition{
+		{Text: "dog", Pos: "noun", Transcription: "dɒg", Translations: []*lookup.Translation{
+			{
+				Text:     "Hund",
+				Pos:      "noun",
+				Synonyms: []string{"Köter"},
+				Meanings: []string{"hound"},
+				Examples: []*lookup.Example{{Text: "barking dog", Translations: []string{"bellender Hund"}}},
+			},
+			{Text: "Rüde", Pos: "noun"},
+		}},
+		{Text: "dog", Pos: "noun", Translations: []*lookup.Translation{{Text: "geiler Bock", Pos: "noun"}}},
+	}, nil
+}
+
+// GetDirs returns directions the mock dictionary supports
+func (d *dictionary) GetDirs(ctx context.Context) ([]string, error) {
+	return []string{"en-de", "de-en"}, nil
+}
+
+// translator is the mock of the translator, which translates black dog to de and Hund to en,
+// detecting the source language itself if it isn't specified
+type translator struct{}
+
+func (t *translator) Translate(ctx context.Context, params *lookup.Params) (string, error) {
+	from := params.From
+	switch {
+	case params.Text == "black dog" && (from == "" || from == "en") && params.To == "de":
+		return "schwarzer Hund", nil
+	case params.Text == "Hund" && (from == "" || from == "de") && params.To == "en":
+		return "dog", nil
+	case (params.Text == "dog" || params.Text == "cat") && from == "" && params.To == "en":
+		// the request in the target language is translated to itself
+		return params.Text, nil
+	}
+	return "", errors.New("no translation")
+}
+
+// Detect returns the language of a few requests the mock translator knows
+func (t *translator) Detect(ctx context.Context, text string) (string, error) {
+	switch text {
+	case "dog", "cat":
+		return "en", nil
+	case "Hund":
+		return "de", nil
+	}
+	return "", errors.New("no translation")
+}
+
+func (t *translator) GetLangs(ctx context.Context, ui string) (*lookup.Languages, error) {
+	if ui != "en" {
+		return nil, errors.New("wrong lang")
+	}
+	return &lookup.Languages{
+		Names: map[string]string{"en": "english", "de": "german", "it": "italian"},
+		Dirs:  []string{"en-de", "en-it", "de-en", "de-it", "it-en", "it-de"},
+	}, nil
+}
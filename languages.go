@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// maxSuggestions limits the number of suggested language codes for the unknown one
+const maxSuggestions = 3
+
+// checkLangs validates languages to translate from and to against lists of languages and directions
+// supported by the provider, which are cached along with responses.
+// Unknown languages and unsupported directions are errors, with suggestions for misspelled language codes.
+// Warnings about directions supported only by the machine translation are written to w.
+// Supported languages are kept to check languages set for records of the data source.
+// Nothing is checked if the provider can't list supported languages
+func (lu *Lu) checkLangs(ctx context.Context, w io.Writer) error {
+	langs, dictDirs, err := lu.fetchLangs(ctx, w)
+	if err != nil || langs == nil {
+		return err
+	}
+	return lu.validateLangs(w, langs, dictDirs)
+}
+
+// fetchLangs returns languages and dictionary directions supported by the provider.
+// Languages are nil if the provider can't list them or they can't be fetched, directions are nil
+// if they can't be fetched, warnings about that are written to w. Only fatal errors, e.g. of the wrong API key, are returned
+func (lu *Lu) fetchLangs(ctx context.Context, w io.Writer) (*lookup.Languages, []string, error) {
+	if !lu.client.CanListLanguages() {
+		return nil, nil, nil
+	}
+	langs, err := lu.client.Languages(ctx, "en")
+	if err != nil {
+		if lookup.KindOf(err) == lookup.ErrFatal {
+			return nil, nil, err
+		}
+		fmt.Fprintf(w, "warning: can't check languages, %s\n", err)
+		return nil, nil, nil
+	}
+
+	dictDirs, err := lu.client.Dirs(ctx)
+	if err != nil {
+		if lookup.KindOf(err) == lookup.ErrFatal {
+			return nil, nil, err
+		}
+		fmt.Fprintf(w, "warning: can't check dictionary directions, %s\n", err)
+	}
+	return langs, dictDirs, nil
+}
+
+// validateLangs checks languages to translate from and to against supported languages and dictionary directions,
+// which are not checked if they are nil, see checkLangs
+func (lu *Lu) validateLangs(w io.Writer, langs *lookup.Languages, dictDirs []string) error {
+	lu.langNames = langs.Names
+
+	codes := lu.opts.ToLangs
+	if lu.opts.FromLang != lookup.AutoLang {
+		codes = append([]string{lu.opts.FromLang}, codes...)
+	}
+	var errs []string
+	for _, code := range codes {
+		if _, ok := langs.Names[code]; ok {
+			continue
+		}
+		errs = append(errs, unknownLangMessage(code, langs.Names))
+	}
+
+	if len(errs) == 0 && lu.opts.FromLang != lookup.AutoLang {
+		for _, to := range lu.opts.ToLangs {
+			if to == lu.opts.FromLang {
+				continue
+			}
+			dir := lu.opts.FromLang + "-" + to
+			inDict := containsString(dictDirs, dir)
+			// empty list of directions means that any pair of supported languages can be translated
+			inMT := len(langs.Dirs) == 0 || containsString(langs.Dirs, dir)
+			switch {
+			case inDict:
+			case lu.opts.DictOnly:
+				if dictDirs != nil {
+					errs = append(errs, fmt.Sprintf("direction %s is not supported by the %s dictionary", dir, lu.client.Provider()))
+				}
+			case inMT:
+				if dictDirs != nil {
+					fmt.Fprintf(w, "warning: direction %s is supported only by the machine translation\n", dir)
+				}
+			default:
+				errs = append(errs, fmt.Sprintf("direction %s is not supported by provider %s", dir, lu.client.Provider()))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// unknownLangMessage returns the message about the unknown language code with suggestions of similar supported ones
+func unknownLangMessage(code string, names map[string]string) string {
+	msg := fmt.Sprintf("unknown language %s", code)
+	if sugs := suggestLangs(code, names); len(sugs) > 0 {
+		msg += ", did you mean " + strings.Join(sugs, " or ") + "?"
+	}
+	return msg
+}
+
+// checkRecordLang checks the language set for the record of the data source, e.g. by the [de] prefix of the line,
+// against supported languages, if they are known. The unknown language doesn't stop the lookup:
+// it is ignored with the warning written to w and its prefix is kept as the part of the request
+func (lu *Lu) checkRecordLang(w io.Writer, rec *record) {
+	if rec.from == "" || lu.langNames == nil {
+		return
+	}
+	if _, ok := lu.langNames[rec.from]; ok {
+		return
+	}
+	fmt.Fprintf(w, "warning: line %d is looked up as is, %s\n", rec.line, unknownLangMessage(rec.from, lu.langNames))
+	if rec.prefixed != "" {
+		rec.text, rec.prefixed = rec.prefixed, ""
+	}
+	rec.from = ""
+}
+
+// suggestLangs returns supported languages similar to the unknown code, as codes with names,
+// they are the ones with close codes or names starting with the code, e.g. de for dee or ger
+func suggestLangs(code string, names map[string]string) []string {
+	code = strings.ToLower(code)
+	dists := make(map[string]int)
+	for c, name := range names {
+		if d := levenshtein(code, c); d <= 1 {
+			dists[c] = d
+		} else if len(code) >= 3 && strings.HasPrefix(strings.ToLower(name), code) {
+			dists[c] = 1
+		}
+	}
+
+	var codes []string
+	for c := range dists {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if dists[codes[i]] != dists[codes[j]] {
+			return dists[codes[i]] < dists[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	if len(codes) > maxSuggestions {
+		codes = codes[:maxSuggestions]
+	}
+
+	sugs := make([]string, len(codes))
+	for i, c := range codes {
+		sugs[i] = fmt.Sprintf("%s (%s)", c, names[c])
+	}
+	return sugs
+}
+
+// containsString reports whether the list contains the string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// levenshtein returns the edit distance between strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// langsList holds languages and translation directions supported by the provider, it is shown by the languages flag
+type langsList struct {
+	UI         string      `json:"ui"`
+	Languages  []*langInfo `json:"languages"`
+	Directions []*dirInfo  `json:"directions"`
+}
+
+// langInfo holds the language code and its name in the UI language
+type langInfo struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// dirInfo holds the translation direction and services of the provider supporting it
+type dirInfo struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Dictionary  bool   `json:"dictionary"`
+	Translation bool   `json:"translation"`
+}
+
+// langsFilter selects directions shown by the languages flag, empty fields match any language
+type langsFilter struct {
+	from string
+	to   string
+	// dictionary and translation keep only directions supported by the corresponding service
+	dictionary  bool
+	translation bool
+}
+
+// supportedDirs returns languages with names in the UI language and translation directions supported by the provider,
+// directions are selected by the filter
+func (lu *Lu) supportedDirs(ctx context.Context, ui string, filter langsFilter) (*langsList, error) {
+	langs, err := lu.client.Languages(ctx, ui)
+	if err != nil {
+		return nil, err
+	}
+	dictDirs, err := lu.client.Dirs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &langsList{UI: ui, Languages: []*langInfo{}, Directions: []*dirInfo{}}
+	for code, name := range langs.Names {
+		list.Languages = append(list.Languages, &langInfo{Code: code, Name: name})
+	}
+	sort.Slice(list.Languages, func(i, j int) bool { return list.Languages[i].Code < list.Languages[j].Code })
+
+	dirs := make(map[string]*dirInfo)
+	add := func(dir string, fn func(d *dirInfo)) {
+		parts := strings.SplitN(dir, "-", 2)
+		if len(parts) != 2 {
+			return
+		}
+		d, ok := dirs[dir]
+		if !ok {
+			d = &dirInfo{From: parts[0], To: parts[1]}
+			dirs[dir] = d
+		}
+		fn(d)
+	}
+	for _, dir := range langs.Dirs {
+		add(dir, func(d *dirInfo) { d.Translation = true })
+	}
+	for _, dir := range dictDirs {
+		add(dir, func(d *dirInfo) { d.Dictionary = true })
+	}
+
+	for _, d := range dirs {
+		if filter.from != "" && d.From != filter.from || filter.to != "" && d.To != filter.to ||
+			filter.dictionary && !d.Dictionary || filter.translation && !d.Translation {
+			continue
+		}
+		list.Directions = append(list.Directions, d)
+	}
+	sort.Slice(list.Directions, func(i, j int) bool {
+		a, b := list.Directions[i], list.Directions[j]
+		return a.From < b.From || a.From == b.From && a.To < b.To
+	})
+	return list, nil
+}
+
+// showLangs prints supported languages, or directions if they are filtered by languages, as text or JSON
+func showLangs(ctx context.Context, w io.Writer, lu *Lu, ui string, filter langsFilter, asJSON bool) error {
+	list, err := lu.supportedDirs(ctx, ui, filter)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	}
+
+	names := make(map[string]string)
+	for _, l := range list.Languages {
+		names[l.Code] = l.Name
+	}
+	name := func(code string) string {
+		if name, ok := names[code]; ok {
+			return name
+		}
+		return lookup.LangName(code)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	switch {
+	case filter.from == "" && filter.to == "":
+		fmt.Fprintln(tw, "Supported languages:")
+		for _, l := range list.Languages {
+			fmt.Fprintf(tw, "%s: %s\n", l.Code, l.Name)
+		}
+	case filter.to == "":
+		fmt.Fprintf(tw, "Directions from %s (%s):\n", filter.from, name(filter.from))
+	case filter.from == "":
+		fmt.Fprintf(tw, "Directions to %s (%s):\n", filter.to, name(filter.to))
+	default:
+		fmt.Fprintf(tw, "Direction %s-%s:\n", filter.from, filter.to)
+	}
+
+	if filter.from != "" || filter.to != "" {
+		if len(list.Directions) == 0 {
+			fmt.Fprintln(tw, "none")
+		}
+		for _, d := range list.Directions {
+			code := d.To
+			if filter.from == "" {
+				code = d.From
+			}
+			var services []string
+			if d.Dictionary {
+				services = append(services, "dictionary")
+			}
+			if d.Translation {
+				services = append(services, "translation")
+			}
+			fmt.Fprintf(tw, "%s-%s\t%s\t%s\n", d.From, d.To, name(code), strings.Join(services, ", "))
+		}
+	}
+	return tw.Flush()
+}
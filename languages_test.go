@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/dafanasev/lu/internal/mock"
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Lu_checkLangs(t *testing.T) {
+	newTestLu := func(opts options) *Lu {
+		return &Lu{opts: opts, client: newMockClient(t, lookup.Options{DictOnly: opts.DictOnly, MTOnly: opts.MTOnly})}
+	}
+	var w bytes.Buffer
+
+	assert.NoError(t, newTestLu(options{FromLang: "en", ToLangs: []string{"de", "en"}}).checkLangs(context.Background(), &w))
+	assert.Empty(t, w.String())
+
+	// pairs without dictionary articles are translated with a warning
+	assert.NoError(t, newTestLu(options{FromLang: "en", ToLangs: []string{"it"}}).checkLangs(context.Background(), &w))
+	assert.Equal(t, "warning: direction en-it is supported only by the machine translation\n", w.String())
+	w.Reset()
+	assert.NoError(t, newTestLu(options{FromLang: "en", ToLangs: []string{"it"}, MTOnly: true}).checkLangs(context.Background(), &w))
+	assert.Empty(t, w.String())
+
+	err := newTestLu(options{FromLang: "en", ToLangs: []string{"it"}, DictOnly: true}).checkLangs(context.Background(), &w)
+	assert.EqualError(t, err, "direction en-it is not supported by the mock dictionary")
+
+	err = newTestLu(options{FromLang: "auto", ToLangs: []string{"dee", "ital", "xx"}}).checkLangs(context.Background(), &w)
+	assert.EqualError(t, err, "unknown language dee, did you mean de (german)?\n"+
+		"unknown language ital, did you mean it (italian)?\n"+
+		"unknown language xx")
+
+	// the language can't be checked if the provider can't list them
+	lu := newTestLu(options{FromLang: "en", ToLangs: []string{"xx"}})
+	d := mock.New().Dictionary
+	lu.client = newTestClient(t, d, &failingTranslator{err: errors.New("connection refused")}, lookup.Options{})
+	assert.NoError(t, lu.checkLangs(context.Background(), &w))
+	assert.Contains(t, w.String(), "warning: can't check languages")
+	tr := &failingTranslator{err: &lookup.APIError{Kind: lookup.ErrFatal, Err: errors.New("(401) API key is invalid")}}
+	lu.client = newTestClient(t, d, tr, lookup.Options{})
+	assert.Error(t, lu.checkLangs(context.Background(), &w))
+	lu.client = newTestClient(t, d, nil, lookup.Options{})
+	assert.NoError(t, lu.checkLangs(context.Background(), &w))
+}
+
+func Test_Lu_checkRecordLang(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "auto", ToLangs: []string{"de"}}, client: newMockClient(t, lookup.Options{})}
+	var w bytes.Buffer
+	// languages are unknown until they are checked
+	rec := &record{text: "Hund", from: "dee"}
+	lu.checkRecordLang(&w, rec)
+	assert.Equal(t, "dee", rec.from)
+
+	require.NoError(t, lu.checkLangs(context.Background(), &bytes.Buffer{}))
+	rec = &record{text: "Hund", from: "de", prefixed: "[de] Hund"}
+	lu.checkRecordLang(&w, rec)
+	assert.Equal(t, &record{text: "Hund", from: "de", prefixed: "[de] Hund"}, rec)
+	assert.Empty(t, w.String())
+
+	// the unknown language is ignored and its prefix is the part of the request
+	rec = &record{text: "Hund", line: 3, from: "dee", prefixed: "[dee] Hund"}
+	lu.checkRecordLang(&w, rec)
+	assert.Equal(t, &record{text: "[dee] Hund", line: 3}, rec)
+	assert.Equal(t, "warning: line 3 is looked up as is, unknown language dee, did you mean de (german)?\n", w.String())
+
+	// as well as the one of the column
+	w.Reset()
+	rec = &record{text: "Hund", line: 4, from: "xx"}
+	lu.checkRecordLang(&w, rec)
+	assert.Equal(t, &record{text: "Hund", line: 4}, rec)
+	assert.Equal(t, "warning: line 4 is looked up as is, unknown language xx\n", w.String())
+}
+
+func Test_suggestLangs(t *testing.T) {
+	names := map[string]string{"de": "German", "en": "English", "es": "Spanish", "et": "Estonian"}
+	assert.Equal(t, []string{"de (German)"}, suggestLangs("dee", names))
+	assert.Equal(t, []string{"de (German)"}, suggestLangs("Ger", names))
+	// no more than maxSuggestions are returned
+	assert.Equal(t, []string{"de (German)", "en (English)", "es (Spanish)"}, suggestLangs("ee", names))
+	assert.Empty(t, suggestLangs("xyz", names))
+}
+
+func Test_levenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("de", "de"))
+	assert.Equal(t, 1, levenshtein("dee", "de"))
+	assert.Equal(t, 2, levenshtein("ru", "it"))
+	assert.Equal(t, 3, levenshtein("", "kür"))
+}
+
+func Test_Lu_supportedDirs(t *testing.T) {
+	lu := &Lu{client: newMockClient(t, lookup.Options{})}
+
+	list, err := lu.supportedDirs(context.Background(), "en", langsFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, "en", list.UI)
+	assert.Equal(t, []*langInfo{{"de", "german"}, {"en", "english"}, {"it", "italian"}}, list.Languages)
+	require.Len(t, list.Directions, 6)
+	assert.Equal(t, &dirInfo{From: "de", To: "en", Dictionary: true, Translation: true}, list.Directions[0])
+
+	list, err = lu.supportedDirs(context.Background(), "en", langsFilter{from: "en"})
+	require.NoError(t, err)
+	assert.Equal(t, []*dirInfo{{"en", "de", true, true}, {"en", "it", false, true}}, list.Directions)
+
+	list, err = lu.supportedDirs(context.Background(), "en", langsFilter{to: "de", dictionary: true})
+	require.NoError(t, err)
+	assert.Equal(t, []*dirInfo{{"en", "de", true, true}}, list.Directions)
+
+	_, err = lu.supportedDirs(context.Background(), "xx", langsFilter{})
+	assert.Error(t, err)
+	lu.client = newTestClient(t, mock.New().Dictionary, nil, lookup.Options{})
+	_, err = lu.supportedDirs(context.Background(), "en", langsFilter{})
+	assert.Error(t, err)
+}
+
+func Test_showLangs(t *testing.T) {
+	lu := &Lu{client: newMockClient(t, lookup.Options{})}
+
+	var b bytes.Buffer
+	require.NoError(t, showLangs(context.Background(), &b, lu, "en", langsFilter{}, false))
+	assert.Equal(t, "Supported languages:\nde: german\nen: english\nit: italian\n", b.String())
+
+	b.Reset()
+	require.NoError(t, showLangs(context.Background(), &b, lu, "en", langsFilter{from: "en"}, false))
+	assert.Equal(t, "Directions from en (english):\n"+
+		"en-de  german   dictionary, translation\n"+
+		"en-it  italian  translation\n", b.String())
+
+	b.Reset()
+	require.NoError(t, showLangs(context.Background(), &b, lu, "en", langsFilter{from: "it", to: "de", dictionary: true}, false))
+	assert.Equal(t, "Direction it-de:\nnone\n", b.String())
+
+	b.Reset()
+	require.NoError(t, showLangs(context.Background(), &b, lu, "en", langsFilter{to: "it"}, true))
+	var list langsList
+	require.NoError(t, json.Unmarshal(b.Bytes(), &list))
+	assert.Len(t, list.Languages, 3)
+	assert.Equal(t, []*dirInfo{{"de", "it", false, true}, {"en", "it", false, true}}, list.Directions)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// control keys handled by the line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines from the terminal in the raw mode,
+// supporting cursor movement, input history and tab completion
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	// history holds previously entered lines, the last one is the newest
+	history []string
+	// complete returns completion candidates for the text before cursor
+	complete func(prefix string) []string
+
+	prompt string
+	line   []rune
+	pos    int
+	// historyPos is the position in history when browsing it, len(history) when not
+	historyPos int
+	// stashed holds the line being edited when browsing history
+	stashed []rune
+}
+
+// newLineEditor creates the line editor reading from in and writing to out
+func newLineEditor(in io.Reader, out io.Writer) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(in), out: out}
+}
+
+// readLine shows the prompt and reads the line.
+// It returns io.EOF if the user presses Ctrl-D on the empty line and errInterrupted on Ctrl-C
+func (ed *lineEditor) readLine(prompt string) (string, error) {
+	ed.prompt = prompt
+	ed.line = nil
+	ed.pos = 0
+	ed.historyPos = len(ed.history)
+	ed.stashed = nil
+	ed.refresh()
+
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(ed.line) > 0 {
+				ed.newline()
+				return string(ed.line), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyCR, keyLF:
+			ed.newline()
+			return string(ed.line), nil
+		case keyCtrlC:
+			io.WriteString(ed.out, "^C")
+			ed.newline()
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(ed.line) == 0 {
+				ed.newline()
+				return "", io.EOF
+			}
+			ed.delete()
+		case keyBackspace, '\b':
+			if ed.pos > 0 {
+				ed.pos--
+				ed.delete()
+			}
+		case keyCtrlA:
+			ed.pos = 0
+		case keyCtrlE:
+			ed.pos = len(ed.line)
+		case keyCtrlB:
+			ed.move(-1)
+		case keyCtrlF:
+			ed.move(1)
+		case keyCtrlK:
+			ed.line = ed.line[:ed.pos]
+		case keyCtrlU:
+			ed.line = append([]rune{}, ed.line[ed.pos:]...)
+			ed.pos = 0
+		case keyCtrlW:
+			ed.deleteWord()
+		case keyCtrlP:
+			ed.browseHistory(-1)
+		case keyCtrlN:
+			ed.browseHistory(1)
+		case keyTab:
+			ed.completeLine()
+		case keyEscape:
+			ed.escapeSequence()
+		default:
+			if r >= ' ' {
+				ed.insert(r)
+			}
+		}
+		ed.refresh()
+	}
+}
+
+// readLineUntil reads the line like readLine, but returns io.EOF as soon as the done channel is closed.
+// Termination signals other than Ctrl-C don't come as key presses in the raw mode, so the read,
+// which can't be interrupted itself, is left blocked and the caller stops waiting for it
+func (ed *lineEditor) readLineUntil(prompt string, done chan struct{}) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	read := make(chan result, 1)
+	go func() {
+		line, err := ed.readLine(prompt)
+		read <- result{line, err}
+	}()
+
+	select {
+	case res := <-read:
+		return res.line, res.err
+	case <-done:
+		return "", io.EOF
+	}
+}
+
+// escapeSequence handles arrows, home, end and delete keys
+func (ed *lineEditor) escapeSequence() {
+	r, _, err := ed.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+	r, _, err = ed.in.ReadRune()
+	if err != nil {
+		return
+	}
+
+	switch r {
+	case 'A':
+		ed.browseHistory(-1)
+	case 'B':
+		ed.browseHistory(1)
+	case 'C':
+		ed.move(1)
+	case 'D':
+		ed.move(-1)
+	case 'H':
+		ed.pos = 0
+	case 'F':
+		ed.pos = len(ed.line)
+	case '1', '3', '4', '7', '8':
+		// sequences like ESC [ 3 ~
+		if next, _, err := ed.in.ReadRune(); err != nil || next != '~' {
+			return
+		}
+		switch r {
+		case '1', '7':
+			ed.pos = 0
+		case '4', '8':
+			ed.pos = len(ed.line)
+		case '3':
+			ed.delete()
+		}
+	}
+}
+
+// addHistory adds the line to the input history, skipping repeated lines
+func (ed *lineEditor) addHistory(line string) {
+	if len(ed.history) > 0 && ed.history[len(ed.history)-1] == line {
+		return
+	}
+	ed.history = append(ed.history, line)
+}
+
+func (ed *lineEditor) insert(r rune) {
+	ed.line = append(ed.line, 0)
+	copy(ed.line[ed.pos+1:], ed.line[ed.pos:])
+	ed.line[ed.pos] = r
+	ed.pos++
+}
+
+// delete deletes the rune under the cursor
+func (ed *lineEditor) delete() {
+	if ed.pos < len(ed.line) {
+		ed.line = append(ed.line[:ed.pos], ed.line[ed.pos+1:]...)
+	}
+}
+
+// deleteWord deletes the word before the cursor
+func (ed *lineEditor) deleteWord() {
+	start := ed.pos
+	for start > 0 && ed.line[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && ed.line[start-1] != ' ' {
+		start--
+	}
+	ed.line = append(ed.line[:start], ed.line[ed.pos:]...)
+	ed.pos = start
+}
+
+func (ed *lineEditor) move(delta int) {
+	ed.pos += delta
+	if ed.pos < 0 {
+		ed.pos = 0
+	}
+	if ed.pos > len(ed.line) {
+		ed.pos = len(ed.line)
+	}
+}
+
+// browseHistory replaces the line with the previous (delta = -1) or the next (delta = 1) one from the history
+func (ed *lineEditor) browseHistory(delta int) {
+	pos := ed.historyPos + delta
+	if pos < 0 || pos > len(ed.history) {
+		return
+	}
+	if ed.historyPos == len(ed.history) {
+		ed.stashed = ed.line
+	}
+
+	ed.historyPos = pos
+	if pos == len(ed.history) {
+		ed.line = ed.stashed
+	} else {
+		ed.line = []rune(ed.history[pos])
+	}
+	ed.pos = len(ed.line)
+}
+
+// completeLine completes the text before the cursor if there is the single candidate,
+// or completes it to the common prefix of all candidates and prints them
+func (ed *lineEditor) completeLine() {
+	if ed.complete == nil {
+		return
+	}
+	prefix := string(ed.line[:ed.pos])
+	candidates := ed.complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+
+	completion := []rune(commonPrefix(candidates))
+	if len(completion) > ed.pos {
+		ed.line = append(completion, ed.line[ed.pos:]...)
+		ed.pos = len(completion)
+		return
+	}
+
+	if len(candidates) > 1 {
+		sort.Strings(candidates)
+		ed.newline()
+		io.WriteString(ed.out, strings.Join(candidates, "  "))
+		ed.newline()
+	}
+}
+
+// refresh redraws the line, placing the cursor to its position
+func (ed *lineEditor) refresh() {
+	fmt.Fprintf(ed.out, "\r%s%s\x1b[K", ed.prompt, string(ed.line))
+	if n := len(ed.line) - ed.pos; n > 0 {
+		fmt.Fprintf(ed.out, "\x1b[%dD", n)
+	}
+}
+
+// newline moves the cursor to the beginning of the next line, the terminal is in the raw mode so \n is not enough
+func (ed *lineEditor) newline() {
+	io.WriteString(ed.out, "\r\n")
+}
+
+// commonPrefix returns the longest common prefix of the strings
+func commonPrefix(strs []string) string {
+	if len(strs) == 0 {
+		return ""
+	}
+	prefix := []rune(strs[0])
+	for _, s := range strs[1:] {
+		rs := []rune(s)
+		n := 0
+		for n < len(prefix) && n < len(rs) && prefix[n] == rs[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lineEditor_readLine(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"dog\r", "dog"},
+		{"dog\n", "dog"},
+		{"dg\x1b[Do\r", "dog"},
+		{"og\x01d\x05s\r", "dogs"},
+		{"dogs\x7f\r", "dog"},
+		{"dogs\x1b[D\x1b[3~\r", "dog"},
+		{"black dog\x17cat\r", "black cat"},
+		{"black dog\x01\x0b\r", ""},
+		{"black dog\x1b[D\x1b[D\x1b[D\x15\r", "dog"},
+		{"dog", "dog"},
+	}
+
+	for _, c := range cases {
+		ed := newLineEditor(strings.NewReader(c.input), &bytes.Buffer{})
+		line, err := ed.readLine("> ")
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, line, "input %q", c.input)
+	}
+}
+
+func Test_lineEditor_readLineUntil(t *testing.T) {
+	ed := newLineEditor(strings.NewReader("dog\r"), &bytes.Buffer{})
+	line, err := ed.readLineUntil("> ", make(chan struct{}))
+	require.NoError(t, err)
+	assert.Equal(t, "dog", line)
+
+	// the read blocked by the terminal without input is abandoned when lu is stopped
+	r, w := io.Pipe()
+	defer w.Close()
+	ed = newLineEditor(r, &bytes.Buffer{})
+	done := make(chan struct{})
+	close(done)
+	_, err = ed.readLineUntil("> ", done)
+	assert.Equal(t, io.EOF, err)
+}
+
+func Test_lineEditor_readLine_keys(t *testing.T) {
+	ed := newLineEditor(strings.NewReader("\x04"), &bytes.Buffer{})
+	_, err := ed.readLine("> ")
+	assert.Equal(t, io.EOF, err)
+
+	ed = newLineEditor(strings.NewReader("dog\x03"), &bytes.Buffer{})
+	_, err = ed.readLine("> ")
+	assert.Equal(t, errInterrupted, err)
+
+	ed = newLineEditor(strings.NewReader(""), &bytes.Buffer{})
+	_, err = ed.readLine("> ")
+	assert.Equal(t, io.EOF, err)
+}
+
+func Test_lineEditor_history(t *testing.T) {
+	ed := newLineEditor(strings.NewReader("\x1b[A\r\x1b[A\x1b[A\r\x1b[A\x1b[A\x1b[A\x1b[Bs\r\x10\x10\x0e\x0e\r"), &bytes.Buffer{})
+	ed.addHistory("cat")
+	ed.addHistory("dog")
+	ed.addHistory("dog")
+	assert.Equal(t, []string{"cat", "dog"}, ed.history)
+
+	for _, expected := range []string{"dog", "cat", "dogs", ""} {
+		line, err := ed.readLine("> ")
+		require.NoError(t, err)
+		assert.Equal(t, expected, line)
+	}
+}
+
+func Test_lineEditor_complete(t *testing.T) {
+	out := &bytes.Buffer{}
+	ed := newLineEditor(strings.NewReader("d\t\r:s\t\r"), out)
+	ed.complete = func(prefix string) []string {
+		var candidates []string
+		for _, s := range []string{"dog", "dolphin", ":save", ":sort"} {
+			if strings.HasPrefix(s, prefix) {
+				candidates = append(candidates, s)
+			}
+		}
+		return candidates
+	}
+
+	line, err := ed.readLine("> ")
+	require.NoError(t, err)
+	assert.Equal(t, "do", line)
+
+	out.Reset()
+	line, err = ed.readLine("> ")
+	require.NoError(t, err)
+	assert.Equal(t, ":s", line)
+	assert.Contains(t, out.String(), ":save  :sort")
+}
+
+func Test_commonPrefix(t *testing.T) {
+	assert.Equal(t, "", commonPrefix(nil))
+	assert.Equal(t, "dog", commonPrefix([]string{"dog"}))
+	assert.Equal(t, "do", commonPrefix([]string{"dog", "dolphin"}))
+	assert.Equal(t, "Hü", commonPrefix([]string{"Hühner", "Hüte"}))
+	assert.Equal(t, "", commonPrefix([]string{"dog", "cat"}))
+}
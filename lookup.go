@@ -1,80 +1,201 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"sort"
-	"strings"
+	"sync"
 
-	yd "github.com/dafanasev/go-yandex-dictionary"
+	"github.com/dafanasev/lu/lookup"
 )
 
+// pendingEntry is the entry which responses are being looked up
+type pendingEntry struct {
+	entry *lookup.Entry
+	wg    sync.WaitGroup
+	// err is the error of the failed lookup or of the data source
+	err error
+	// doneLine is the last source line which segments are all scheduled up to the entry
+	doneLine int
+}
+
 // lookupCycle iterates through data source line by line,
 // making look ups for all needed languages for non empty lines
 // adding results wrapped into entries struct to the history list and
 // passing them to the corresponding channel.
-// The cycle can be stopped at any moment using done channel
-func (lu *Lu) lookupCycle(done chan struct{}, entriesCh chan *entry) {
-	for {
+// Look ups are made concurrently, by no more than opts.Jobs at once, which the client allows,
+// but entries are passed to the channel in the input order.
+// The cycle can be stopped at any moment using done channel,
+// it stops itself if the lookup fails, the error is kept in lu.err
+func (lu *Lu) lookupCycle(done chan struct{}, entriesCh chan *lookup.Entry) {
+	defer close(entriesCh)
+
+	// the cycle stopped before the start doesn't read the data source at all
+	if isClosed(done) {
+		return
+	}
+
+	// the context is cancelled when the cycle is stopped by the caller, fails or ends
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
 		select {
 		case <-done:
-			close(entriesCh)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	jobs := lu.opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	// pending holds entries in the input order, it is buffered to let look ups run ahead of the slowest one
+	pending := make(chan *pendingEntry, jobs)
+	go lu.scheduleLookups(ctx, done, pending)
+
+	for pe := range pending {
+		pe.wg.Wait()
+		if pe.err != nil {
+			// lookups of the stopped cycle fail with the context error
+			if ctx.Err() == nil {
+				lu.err = pe.err
+			}
 			return
-		default:
-			if !lu.scanner.Scan() {
-				close(entriesCh)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case entriesCh <- lu.passed(pe):
+			lu.history = append(lu.history, pe.entry)
+		}
+	}
+	// pending channel is closed after the input is read to the end or the cycle is stopped
+	lu.completed = lu.eof
+}
+
+// scheduleLookups reads data source record by record and starts look ups for all needed languages.
+// Lines already processed by the interrupted run are skipped.
+// The done channel is checked before each read along with the context,
+// which is cancelled asynchronously, so no record is read after the cycle is stopped
+func (lu *Lu) scheduleLookups(ctx context.Context, done chan struct{}, pending chan *pendingEntry) {
+	defer close(pending)
+
+	seg := lu.segmenter
+	if seg == nil {
+		seg = &lineSegmenter{}
+	}
+
+	line := 0
+	for {
+		if ctx.Err() != nil || isClosed(done) {
+			return
+		}
+
+		var segs []*segment
+		rec, err := lu.input.read()
+		if err == nil {
+			lu.checkRecordLang(os.Stderr, rec)
+			line = rec.line
+			segs = seg.add(rec)
+		} else {
+			segs = seg.flush()
+		}
+
+		for i, s := range segs {
+			// repeated requests are counted, but looked up only once,
+			// including requests of lines skipped on resume, which are already in the destination file
+			first := lu.occurrences == nil || lu.occurrences.add(s.text, s.src.from, s.src.line)
+			if !first || s.src.line <= lu.skipLines {
+				continue
+			}
+
+			// the language can be set for the request in the data source
+			from := s.src.from
+			if from == "" {
+				from = lu.opts.FromLang
+			}
+			e := &lookup.Entry{Request: s.text, Line: s.src.line, Context: s.context, From: from, Meta: s.src.meta}
+			pe := &pendingEntry{entry: e, doneLine: doneLine(segs, i, seg, line)}
+			pe.wg.Add(1)
+			go func() {
+				defer pe.wg.Done()
+				pe.err = lu.client.LookupEntry(ctx, pe.entry, lu.opts.ToLangs)
+			}()
+
+			select {
+			case <-ctx.Done():
 				return
+			case pending <- pe:
 			}
+		}
 
-			req := strings.TrimSpace(lu.scanner.Text())
-			if req != "" {
-				entry := &entry{Request: req}
-				for _, lang := range lu.opts.ToLangs {
-					translations := lu.lookup(req, lang)
-					resp := &response{Lang: lang, Translations: translations}
-					entry.Responses = append(entry.Responses, resp)
-				}
-				entriesCh <- entry
-				lu.history = append(lu.history, entry)
+		if err == io.EOF {
+			lu.eof = true
+			return
+		}
+		if err != nil {
+			// the read error stops the cycle after entries read before it
+			select {
+			case <-ctx.Done():
+			case pending <- &pendingEntry{err: err}:
 			}
+			return
 		}
 	}
 }
 
-// lookup returns results of the call to dictionary and,
-// if there are no ones, to translator
-// It returns "no translation" if the call to translator returns no results too
-func (lu *Lu) lookup(req string, lang string) []string {
-	dictResp, err := lu.dictionary.Lookup(&yd.Params{Lang: lu.opts.FromLang + "-" + lang, Text: req})
-
-	if err == nil {
-		var trs []string
-		// iterating through yandex dictionary data structures
-		// to accumulate all definitions in a list and return it
-		for _, def := range dictResp.Def {
-			for _, tr := range def.Tr {
-				trs = append(trs, tr.Text)
-			}
-		}
-		return trs
+// doneLine returns the last source line which segments are all among the first i+1 segments,
+// i.e. the line before the start of the next segment, which may be still buffered by the segmenter.
+// Sentences can span several lines, so the line is not complete until the sentence is
+func doneLine(segs []*segment, i int, seg segmenter, line int) int {
+	if i+1 < len(segs) {
+		return segs[i+1].src.line - 1
+	}
+	if rec := seg.buffered(); rec != nil {
+		return rec.line - 1
 	}
+	return line
+}
 
-	transResp, err := lu.translator.Translate(lang, req)
-	// translator returns request string as the result if there is no translation
-	if err != nil || transResp.Result() == req {
-		return []string{"no translation"}
+// passed records the last complete source line of the entry, which is about to be passed by the lookup cycle,
+// it is saved as the resume point when the entry is written to the destination file
+func (lu *Lu) passed(pe *pendingEntry) *lookup.Entry {
+	lu.doneMu.Lock()
+	defer lu.doneMu.Unlock()
+	if lu.doneLines == nil {
+		lu.doneLines = make(map[*lookup.Entry]int)
 	}
+	lu.doneLines[pe.entry] = pe.doneLine
+	return pe.entry
+}
+
+// isClosed reports whether the channel is closed, without blocking
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
 
-	return []string{transResp.Result()}
+// lookupEntry looks the request up for all needed languages at once,
+// it is used in the interactive mode and by the server, where requests come one by one
+func (lu *Lu) lookupEntry(ctx context.Context, req string) (*lookup.Entry, error) {
+	return lu.client.Lookup(ctx, req, lu.opts.FromLang, lu.opts.ToLangs)
 }
 
-// supportedLangs returns the list of the languages supported by Yandex APIs
-func (lu *Lu) supportedLangs(ui string) ([]string, error) {
-	resp, err := lu.translator.GetLangs(ui)
+// supportedLangs returns the list of the languages supported by the provider
+func (lu *Lu) supportedLangs(ctx context.Context, ui string) ([]string, error) {
+	resp, err := lu.client.Languages(ctx, ui)
 	if err != nil {
 		return nil, err
 	}
 	var langs []string
-	for abbr, lang := range resp.Langs {
+	for abbr, lang := range resp.Names {
 		langs = append(langs, fmt.Sprintf("%s: %s", abbr, lang))
 	}
 	sort.Strings(langs)
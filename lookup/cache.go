@@ -0,0 +1,346 @@
+package lookup
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cacheFileExt is the extension of files holding cached responses
+const cacheFileExt = ".json"
+
+// Cache is the on-disk storage for API responses, it can be shared by clients of different providers.
+// Every response is kept in its own file, named after the hash of the key
+type Cache struct {
+	dir string
+	// time to live of the cached responses, zero means they never expire
+	ttl time.Duration
+	// maximum size of the cache in bytes, zero means unlimited
+	maxSize int64
+	// Refresh makes the cache ignore stored responses, they are overwritten by the new ones
+	Refresh bool
+
+	mu   sync.Mutex
+	size int64
+}
+
+// cacheRecord is the content of the single cache file
+type cacheRecord struct {
+	Key     string
+	Created time.Time
+	Value   json.RawMessage
+}
+
+// CacheStats holds the cache statistics
+type CacheStats struct {
+	Entries int
+	Expired int
+	Size    int64
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// NewCache creates the cache directory if it doesn't exist and returns the cache using it
+func NewCache(dir string, ttl time.Duration, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "can't create cache directory")
+	}
+	c := &Cache{dir: dir, ttl: ttl, maxSize: maxSize}
+
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		c.size += fi.Size()
+	}
+
+	return c, nil
+}
+
+// get loads the value stored by the key into v, it returns false if there is no such value or it is expired
+func (c *Cache) get(key string, v interface{}) bool {
+	if c.Refresh {
+		return false
+	}
+
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return false
+	}
+
+	var rec cacheRecord
+	// the same hash for different keys is highly unlikely but cheap to check
+	if err = json.Unmarshal(data, &rec); err != nil || rec.Key != key {
+		return false
+	}
+	if c.expired(rec.Created) {
+		return false
+	}
+
+	return json.Unmarshal(rec.Value, v) == nil
+}
+
+// set stores the value by the key and evicts the oldest entries if the cache is too big
+func (c *Cache) set(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&cacheRecord{Key: key, Created: time.Now(), Value: value})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := c.path(key)
+	if fi, err := os.Stat(path); err == nil {
+		c.size -= fi.Size()
+	}
+
+	// write to the temporary file first, so readers never see the partially written one
+	tmp, err := ioutil.TempFile(c.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	c.size += int64(len(data))
+
+	if c.maxSize > 0 && c.size > c.maxSize {
+		return c.evict()
+	}
+	return nil
+}
+
+// evict removes the oldest entries until the cache size is 90% of the maximum one.
+// It must be called with the mutex locked
+func (c *Cache) evict() error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	for _, fi := range files {
+		if c.size <= c.maxSize*9/10 {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, fi.Name())); err != nil {
+			return err
+		}
+		c.size -= fi.Size()
+	}
+	return nil
+}
+
+// Stats returns the cache statistics
+func (c *Cache) Stats() (*CacheStats, error) {
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+
+	st := &CacheStats{Entries: len(files)}
+	for _, fi := range files {
+		st.Size += fi.Size()
+		if c.expired(fi.ModTime()) {
+			st.Expired++
+		}
+		if st.Oldest.IsZero() || fi.ModTime().Before(st.Oldest) {
+			st.Oldest = fi.ModTime()
+		}
+		if fi.ModTime().After(st.Newest) {
+			st.Newest = fi.ModTime()
+		}
+	}
+	return st, nil
+}
+
+// Purge removes expired entries or all of them, if the all argument is set, and returns number of removed entries
+func (c *Cache) Purge(all bool) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := c.files()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, fi := range files {
+		if !all && !c.expired(fi.ModTime()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, fi.Name())); err != nil {
+			return n, err
+		}
+		c.size -= fi.Size()
+		n++
+	}
+	return n, nil
+}
+
+// files returns info about all cache files
+func (c *Cache) files() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read cache directory")
+	}
+
+	var files []os.FileInfo
+	for _, fi := range infos {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), cacheFileExt) {
+			files = append(files, fi)
+		}
+	}
+	return files, nil
+}
+
+func (c *Cache) path(key string) string {
+	h := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(h[:])+cacheFileExt)
+}
+
+func (c *Cache) expired(created time.Time) bool {
+	return c.ttl > 0 && time.Since(created) > c.ttl
+}
+
+// cachedDictionary implements Dictionary interface,
+// returning cached responses if possible and passing requests to the wrapped dictionary otherwise
+type cachedDictionary struct {
+	Dictionary
+	cache    *Cache
+	provider string
+}
+
+func (d *cachedDictionary) Lookup(ctx context.Context, params *Params) ([]*Definition, error) {
+	dir := params.From + "-" + params.To
+	// responses depend on dictionary options, keys of responses for default ones are kept intact
+	if opts := params.dictionaryOptions(); opts != "" {
+		dir += ";" + opts
+	}
+	key := fmt.Sprintf("%s:dictionary:%s:%s", d.provider, dir, params.Text)
+
+	var defs []*Definition
+	if d.cache.get(key, &defs) {
+		return defs, nil
+	}
+
+	defs, err := d.Dictionary.Lookup(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	// failure to write to the cache must not break the lookup
+	d.cache.set(key, defs)
+
+	return defs, nil
+}
+
+// GetDirs returns directions supported by the wrapped dictionary, or nil if it can't list them
+func (d *cachedDictionary) GetDirs(ctx context.Context) ([]string, error) {
+	l, ok := d.Dictionary.(DirsLister)
+	if !ok {
+		return nil, nil
+	}
+	key := fmt.Sprintf("%s:dictionary:dirs", d.provider)
+
+	var dirs []string
+	if d.cache.get(key, &dirs) {
+		return dirs, nil
+	}
+
+	dirs, err := l.GetDirs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.cache.set(key, dirs)
+
+	return dirs, nil
+}
+
+// cachedTranslator implements Translator interface,
+// returning cached responses if possible and passing requests to the wrapped translator otherwise
+type cachedTranslator struct {
+	Translator
+	cache    *Cache
+	provider string
+}
+
+func (t *cachedTranslator) Translate(ctx context.Context, params *Params) (string, error) {
+	key := fmt.Sprintf("%s:translate:%s-%s:%s", t.provider, params.From, params.To, params.Text)
+
+	var result string
+	if t.cache.get(key, &result) {
+		return result, nil
+	}
+
+	result, err := t.Translator.Translate(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	t.cache.set(key, result)
+
+	return result, nil
+}
+
+// Detect detects the language using the wrapped translator, it must implement Detector interface
+func (t *cachedTranslator) Detect(ctx context.Context, text string) (string, error) {
+	d, ok := t.Translator.(Detector)
+	if !ok {
+		return "", errors.Errorf("provider %s can't detect languages", t.provider)
+	}
+	key := fmt.Sprintf("%s:detect:%s", t.provider, text)
+
+	var lang string
+	if t.cache.get(key, &lang) {
+		return lang, nil
+	}
+
+	lang, err := d.Detect(ctx, text)
+	if err != nil {
+		return "", err
+	}
+	t.cache.set(key, lang)
+
+	return lang, nil
+}
+
+func (t *cachedTranslator) GetLangs(ctx context.Context, ui string) (*Languages, error) {
+	key := fmt.Sprintf("%s:langs:%s", t.provider, ui)
+
+	var langs Languages
+	if t.cache.get(key, &langs) {
+		return &langs, nil
+	}
+
+	l, err := t.Translator.GetLangs(ctx, ui)
+	if err != nil {
+		return nil, err
+	}
+	t.cache.set(key, l)
+
+	return l, nil
+}
@@ -0,0 +1,197 @@
+package lookup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDictionary counts calls to the wrapped dictionary
+type countingDictionary struct {
+	Dictionary
+	calls int
+}
+
+func (d *countingDictionary) Lookup(ctx context.Context, params *Params) ([]*Definition, error) {
+	d.calls++
+	return d.Dictionary.Lookup(ctx, params)
+}
+
+// countingTranslator counts calls to the wrapped translator
+type countingTranslator struct {
+	Translator
+	calls int
+}
+
+func (t *countingTranslator) Translate(ctx context.Context, params *Params) (string, error) {
+	t.calls++
+	return t.Translator.Translate(ctx, params)
+}
+
+func withCache(t *testing.T, ttl time.Duration, maxSize int64, fn func(c *Cache)) {
+	dir, err := ioutil.TempDir("", "lu-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := NewCache(dir, ttl, maxSize)
+	require.NoError(t, err)
+	fn(c)
+}
+
+func Test_cache_getSet(t *testing.T) {
+	withCache(t, 0, 0, func(c *Cache) {
+		var v []string
+		assert.False(t, c.get("key", &v))
+
+		require.NoError(t, c.set("key", []string{"Hund"}))
+		assert.True(t, c.get("key", &v))
+		assert.Equal(t, []string{"Hund"}, v)
+
+		c.Refresh = true
+		assert.False(t, c.get("key", &v))
+	})
+
+	withCache(t, time.Nanosecond, 0, func(c *Cache) {
+		require.NoError(t, c.set("key", "Hund"))
+		time.Sleep(time.Millisecond)
+		var v string
+		assert.False(t, c.get("key", &v))
+	})
+}
+
+func Test_cache_evict(t *testing.T) {
+	withCache(t, 0, 200, func(c *Cache) {
+		for _, key := range []string{"one", "two", "three", "four"} {
+			require.NoError(t, c.set(key, key))
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.True(t, c.size <= 200)
+
+		var v string
+		assert.False(t, c.get("one", &v))
+		assert.True(t, c.get("four", &v))
+	})
+}
+
+func Test_cache_statsPurge(t *testing.T) {
+	withCache(t, time.Hour, 0, func(c *Cache) {
+		require.NoError(t, c.set("one", 1))
+		require.NoError(t, c.set("two", 2))
+		// make the first entry expired
+		old := time.Now().Add(-2 * time.Hour)
+		require.NoError(t, os.Chtimes(c.path("one"), old, old))
+
+		st, err := c.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, 2, st.Entries)
+		assert.Equal(t, 1, st.Expired)
+		assert.Equal(t, c.size, st.Size)
+
+		n, err := c.Purge(false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		n, err = c.Purge(true)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, int64(0), c.size)
+	})
+}
+
+func Test_cachedDictionary_Lookup(t *testing.T) {
+	withCache(t, 0, 0, func(c *Cache) {
+		d := &countingDictionary{Dictionary: &yandexDictionary{api: &dictionaryMock{}}}
+		cd := &cachedDictionary{Dictionary: d, cache: c, provider: "mock"}
+
+		for i := 0; i < 2; i++ {
+			defs, err := cd.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "dog"})
+			require.NoError(t, err)
+			assert.Equal(t, "Hund", defs[0].Translations[0].Text)
+			assert.Equal(t, "dɒg", defs[0].Transcription)
+		}
+		assert.Equal(t, 1, d.calls)
+
+		// errors are not cached
+		for i := 0; i < 2; i++ {
+			_, err := cd.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "cat"})
+			require.Error(t, err)
+		}
+		assert.Equal(t, 3, d.calls)
+
+		// responses for other dictionary options are cached separately
+		for i := 0; i < 2; i++ {
+			_, err := cd.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "dog", Morpho: true})
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 4, d.calls)
+	})
+}
+
+func Test_cachedDictionary_GetDirs(t *testing.T) {
+	withCache(t, 0, 0, func(c *Cache) {
+		cd := &cachedDictionary{Dictionary: &yandexDictionary{api: &dictionaryMock{}}, cache: c, provider: "mock"}
+		for i := 0; i < 2; i++ {
+			dirs, err := cd.GetDirs(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"en-de", "de-en"}, dirs)
+		}
+
+		// dictionaries which can't list directions return nil
+		cd = &cachedDictionary{Dictionary: &dictdDictionary{}, cache: c, provider: "dictd"}
+		dirs, err := cd.GetDirs(context.Background())
+		assert.NoError(t, err)
+		assert.Nil(t, dirs)
+	})
+}
+
+func Test_cachedTranslator(t *testing.T) {
+	withCache(t, 0, 0, func(c *Cache) {
+		tr := &countingTranslator{Translator: &yandexTranslator{api: &translatorMock{}}}
+		ct := &cachedTranslator{Translator: tr, cache: c, provider: "mock"}
+
+		for i := 0; i < 2; i++ {
+			result, err := ct.Translate(context.Background(), &Params{From: "en", To: "de", Text: "black dog"})
+			require.NoError(t, err)
+			assert.Equal(t, "schwarzer Hund", result)
+		}
+		assert.Equal(t, 1, tr.calls)
+
+		// the same request to the other provider is not served from the cache
+		other := &cachedTranslator{Translator: tr, cache: c, provider: "other"}
+		_, err := other.Translate(context.Background(), &Params{From: "en", To: "de", Text: "black dog"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, tr.calls)
+
+		// languages are cached too
+		for i := 0; i < 2; i++ {
+			langs, err := ct.GetLangs(context.Background(), "en")
+			require.NoError(t, err)
+			assert.Equal(t, "german", langs.Names["de"])
+		}
+	})
+}
+
+func Test_cachedTranslator_Detect(t *testing.T) {
+	withCache(t, time.Hour, 0, func(c *Cache) {
+		ct := &cachedTranslator{Translator: &yandexTranslator{api: &translatorMock{}}, cache: c, provider: "mock"}
+		lang, err := ct.Detect(context.Background(), "Hund")
+		require.NoError(t, err)
+		assert.Equal(t, "de", lang)
+
+		var cached string
+		assert.True(t, c.get("mock:detect:Hund", &cached))
+		assert.Equal(t, "de", cached)
+
+		_, err = ct.Detect(context.Background(), "xyz")
+		assert.Error(t, err)
+
+		ct = &cachedTranslator{Translator: &countingTranslator{Translator: ct.Translator}, cache: c, provider: "mock"}
+		_, err = ct.Detect(context.Background(), "Hund")
+		assert.EqualError(t, err, "provider mock can't detect languages")
+	})
+}
@@ -0,0 +1,346 @@
+package lookup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AutoLang is the source language value used to detect the language of each request
+const AutoLang = "auto"
+
+// Options holds settings of the client, zero values turn the corresponding features off
+type Options struct {
+	// UI is the language of the dictionary interface, e.g. names of parts of speech
+	UI string
+	// Family turns on the family filter, excluding obscene words
+	Family bool
+	// Morpho turns on the search by word forms, e.g. dog for dogs
+	Morpho bool
+	// PosFilter keeps translations having the same part of speech as the request
+	PosFilter bool
+	// DictOnly limits lookups to the dictionary, without falling back to the machine translation
+	DictOnly bool
+	// MTOnly limits lookups to the machine translation, without looking the dictionary up
+	MTOnly bool
+	// Jobs limits the number of simultaneous requests to the provider, it is 1 if not set
+	Jobs int
+	// Retries is the number of retries of transient failures, e.g. network errors or rate limiting
+	Retries int
+	// RetryBackoff is the delay before the first retry, it is doubled for the next ones
+	RetryBackoff time.Duration
+	// RateLimit limits the number of requests to the provider per second, zero means unlimited
+	RateLimit float64
+	// Cache stores responses of the provider, nil means that they are not cached
+	Cache *Cache
+}
+
+// Client looks requests up using the dictionary and, if there is no dictionary article,
+// the machine translation of the provider. It is safe for concurrent use
+type Client struct {
+	provider   string
+	dictionary Dictionary
+	translator Translator
+	// canDetect is set if the translator of the provider can detect languages
+	canDetect bool
+	opts      Options
+	// sem limits the number of simultaneous requests to the provider
+	sem chan struct{}
+}
+
+// New creates the client using the provider.
+// Requests are retried and limited by the rate, if it is set in options,
+// cached responses are returned without waiting, so the cache wraps them
+func New(p *Provider, opts Options) (*Client, error) {
+	if opts.DictOnly && opts.MTOnly {
+		return nil, errors.New("lookups can't be limited to both the dictionary and the machine translation")
+	}
+	if opts.DictOnly && p.Dictionary == nil {
+		return nil, errors.Errorf("provider %s has no dictionary, it can't be used for dictionary only lookups", p.Name)
+	}
+	if opts.MTOnly && p.Translator == nil {
+		return nil, errors.Errorf("provider %s has no translator, it can't be used for machine translation only lookups", p.Name)
+	}
+
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	c := &Client{
+		provider:   p.Name,
+		dictionary: p.Dictionary,
+		translator: p.Translator,
+		opts:       opts,
+		sem:        make(chan struct{}, jobs),
+	}
+	_, c.canDetect = c.translator.(Detector)
+
+	if opts.Retries > 0 || opts.RateLimit > 0 {
+		c.setupRetries()
+	}
+	if opts.Cache != nil {
+		c.setupCache()
+	}
+	return c, nil
+}
+
+// setupRetries wraps dictionary and translator with the ones retrying transient failures and limiting the rate of requests
+func (c *Client) setupRetries() {
+	r := &retrier{
+		retries: c.opts.Retries,
+		backoff: c.opts.RetryBackoff,
+		limiter: newRateLimiter(c.opts.RateLimit),
+		sleep:   sleepContext,
+	}
+	if c.dictionary != nil {
+		c.dictionary = &retryingDictionary{Dictionary: c.dictionary, retrier: r}
+	}
+	if c.translator != nil {
+		c.translator = &retryingTranslator{Translator: c.translator, retrier: r}
+	}
+}
+
+// setupCache wraps dictionary and translator with the cached ones.
+// Provider name is used to distinguish responses of different providers
+func (c *Client) setupCache() {
+	if c.dictionary != nil {
+		c.dictionary = &cachedDictionary{Dictionary: c.dictionary, cache: c.opts.Cache, provider: c.provider}
+	}
+	if c.translator != nil {
+		c.translator = &cachedTranslator{Translator: c.translator, cache: c.opts.Cache, provider: c.provider}
+	}
+}
+
+// Provider returns the name of the provider
+func (c *Client) Provider() string {
+	return c.provider
+}
+
+// CanDetect reports whether the provider can detect languages of requests
+func (c *Client) CanDetect() bool {
+	return c.canDetect
+}
+
+// CanListLanguages reports whether the provider can list supported languages
+func (c *Client) CanListLanguages() bool {
+	return c.translator != nil
+}
+
+// Lookup looks the text up, translating it from the source language to each of the target ones.
+// The source language is detected if it is empty or AutoLang, the target language equal to it is skipped.
+// Errors specific to the request, e.g. the unsupported direction, are reported in responses,
+// other ones, e.g. the invalid API key or the network failure, are returned
+func (c *Client) Lookup(ctx context.Context, text, from string, to []string) (*Entry, error) {
+	e := &Entry{Request: text, From: from}
+	if err := c.LookupEntry(ctx, e, to); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// LookupBatch looks the texts up concurrently, as many at once as the client allows,
+// and returns entries in the order of texts. The first error stops the batch
+func (c *Client) LookupBatch(ctx context.Context, texts []string, from string, to []string) ([]*Entry, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	entries := make([]*Entry, len(texts))
+	errs := make([]error, len(texts))
+	var wg sync.WaitGroup
+	for i, text := range texts {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			entries[i], errs[i] = c.Lookup(ctx, text, from, to)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, text)
+	}
+	wg.Wait()
+
+	// the cancelled lookups fail because of the first error
+	for _, err := range errs {
+		if err != nil && err != context.Canceled {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// LookupEntry fills responses of the entry, made from the request and,
+// optionally, its source language and other data, e.g. the number of the source line.
+// It detects the source language of the request, if it is not specified,
+// and looks the request up for all target languages except the source one.
+// Lookups are stopped when the context is done, the context error is returned in this case
+func (c *Client) LookupEntry(ctx context.Context, e *Entry, to []string) error {
+	if e.From == "" || e.From == AutoLang {
+		if err := c.acquire(ctx); err != nil {
+			return err
+		}
+		lang, err := c.detect(ctx, e.Request)
+		c.release()
+		if err != nil {
+			// the detection interrupted by the context can fail with other errors
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		e.From, e.Detected = lang, lang != ""
+	}
+
+	var langs []string
+	for _, lang := range to {
+		if lang != e.From {
+			langs = append(langs, lang)
+		}
+	}
+
+	responses := make([]*Response, len(langs))
+	errs := make([]error, len(langs))
+	var wg sync.WaitGroup
+	for i, lang := range langs {
+		if err := c.acquire(ctx); err != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, lang string) {
+			defer func() {
+				c.release()
+				wg.Done()
+			}()
+			responses[i], errs[i] = c.lookup(ctx, e.Request, e.From, lang)
+		}(i, lang)
+	}
+	wg.Wait()
+
+	// if the work is stopped, some responses are missing and others can fail because of interrupted calls
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	e.Responses = append(e.Responses, responses...)
+	return nil
+}
+
+// acquire waits until the request to the provider is allowed or the context is done
+func (c *Client) acquire(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case c.sem <- struct{}{}:
+		return nil
+	}
+}
+
+// release lets other requests to the provider go
+func (c *Client) release() {
+	<-c.sem
+}
+
+// detect returns the language of the request or the empty string if it can't be detected,
+// in the latter case translator tries to detect the language itself.
+// Errors which are not specific to the request are returned
+func (c *Client) detect(ctx context.Context, req string) (string, error) {
+	d, ok := c.translator.(Detector)
+	if !ok || !c.canDetect {
+		return "", nil
+	}
+	lang, err := d.Detect(ctx, req)
+	if err != nil {
+		if KindOf(err) != ErrRequest {
+			return "", err
+		}
+		return "", nil
+	}
+	return lang, nil
+}
+
+// lookup returns results of the call to dictionary and,
+// if there are no ones, to translator.
+// The empty source language means that only translator is used, it detects the language itself.
+// The status of the response tells where translations come from or why there are no ones.
+// The dictionary or translator is skipped if the lookup is limited to the other one by options.
+// Errors which are not specific to the request, e.g. the invalid API key or the network failure, are returned
+func (c *Client) lookup(ctx context.Context, req, from, lang string) (*Response, error) {
+	resp := &Response{Lang: lang, Status: StatusNotFound, Provider: c.provider}
+	params := &Params{
+		From:      from,
+		To:        lang,
+		Text:      req,
+		UI:        c.opts.UI,
+		Family:    c.opts.Family,
+		Morpho:    c.opts.Morpho,
+		PosFilter: c.opts.PosFilter,
+	}
+	useDictionary := c.dictionary != nil && !c.opts.MTOnly
+	useTranslator := c.translator != nil && !c.opts.DictOnly
+
+	if useDictionary && from != "" {
+		defs, err := c.dictionary.Lookup(ctx, params)
+		if err != nil && KindOf(err) != ErrRequest {
+			return nil, err
+		}
+		if err == nil && len(defs) > 0 {
+			resp.Status, resp.Mode = StatusDictionary, ModeDictionary
+			resp.Definitions = defs
+			// accumulate all translations of all definitions in the flat list
+			for _, def := range resp.Definitions {
+				for _, tr := range def.Translations {
+					resp.Translations = append(resp.Translations, tr.Text)
+				}
+			}
+			return resp, nil
+		}
+		// the dictionary doesn't support many directions, so its errors matter only if there is no translator
+		if !useTranslator {
+			resp.setError(err, ModeDictionary)
+		}
+	}
+
+	if useTranslator {
+		result, err := c.translator.Translate(ctx, params)
+		if err != nil && KindOf(err) != ErrRequest {
+			return nil, err
+		}
+		// translator returns request string as the result if there is no translation
+		if err == nil && result != "" && result != req {
+			resp.Status, resp.Mode = StatusTranslation, ModeTranslation
+			resp.Translations = []string{result}
+			return resp, nil
+		}
+		resp.setError(err, ModeTranslation)
+	}
+
+	return resp, nil
+}
+
+// Languages returns languages and translation directions supported by the provider,
+// ui is the language of language names
+func (c *Client) Languages(ctx context.Context, ui string) (*Languages, error) {
+	if c.translator == nil {
+		return nil, errors.Errorf("provider %s can't list supported languages", c.provider)
+	}
+	return c.translator.GetLangs(ctx, ui)
+}
+
+// Dirs returns translation directions supported by the dictionary of the provider, e.g. en-de,
+// nil list means that supported directions are unknown or the dictionary is not used
+func (c *Client) Dirs(ctx context.Context) ([]string, error) {
+	l, ok := c.dictionary.(DirsLister)
+	if !ok || c.opts.MTOnly {
+		return nil, nil
+	}
+	return l.GetDirs(ctx)
+}
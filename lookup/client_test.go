@@ -0,0 +1,296 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	yd "github.com/dafanasev/go-yandex-dictionary"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates the client using the dictionary and translator of the mock provider
+func newTestClient(t *testing.T, d Dictionary, tr Translator, opts Options) *Client {
+	c, err := New(&Provider{Name: "mock", Dictionary: d, Translator: tr}, opts)
+	require.NoError(t, err)
+	return c
+}
+
+func Test_New(t *testing.T) {
+	c, err := New(newMockProvider(), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "mock", c.Provider())
+	assert.True(t, c.CanDetect())
+	assert.Equal(t, 1, cap(c.sem))
+
+	_, err = New(NewDictd("localhost:2628", nil), Options{MTOnly: true})
+	assert.EqualError(t, err, "provider dictd has no translator, it can't be used for machine translation only lookups")
+	_, err = New(NewLibreTranslate("http://localhost:5000", ""), Options{DictOnly: true})
+	assert.EqualError(t, err, "provider libretranslate has no dictionary, it can't be used for dictionary only lookups")
+	_, err = New(newMockProvider(), Options{DictOnly: true, MTOnly: true})
+	assert.Error(t, err)
+
+	c, err = New(NewDictd("localhost:2628", nil), Options{Jobs: 4, Retries: 2})
+	require.NoError(t, err)
+	assert.False(t, c.CanDetect())
+	assert.Equal(t, 4, cap(c.sem))
+	assert.IsType(t, &retryingDictionary{}, c.dictionary)
+	assert.Nil(t, c.translator)
+}
+
+func Test_New_cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lu-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := NewCache(dir, 0, 0)
+	require.NoError(t, err)
+
+	c := newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, &yandexTranslator{api: &translatorMock{}}, Options{Cache: cache})
+	cd, ok := c.dictionary.(*cachedDictionary)
+	require.True(t, ok)
+	assert.Equal(t, cache, cd.cache)
+	assert.Equal(t, "mock", cd.provider)
+	assert.IsType(t, &cachedTranslator{}, c.translator)
+
+	// providers without translator are not wrapped with nil
+	c = newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, nil, Options{Cache: cache})
+	assert.Nil(t, c.translator)
+}
+
+func Test_Client_lookup(t *testing.T) {
+	c := newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, &yandexTranslator{api: &translatorMock{}}, Options{})
+
+	resp, err := c.lookup(context.Background(), "dog", "en", "de")
+	require.NoError(t, err)
+	assert.Equal(t, "de", resp.Lang)
+	assert.Equal(t, StatusDictionary, resp.Status)
+	assert.Equal(t, ModeDictionary, resp.Mode)
+	assert.Equal(t, []string{"Hund", "Rüde", "geiler Bock"}, resp.Translations)
+	require.Len(t, resp.Definitions, 2)
+	def := resp.Definitions[0]
+	assert.Equal(t, "noun", def.Pos)
+	assert.Equal(t, "dɒg", def.Transcription)
+	require.Len(t, def.Translations, 2)
+	assert.Equal(t, []string{"Köter"}, def.Translations[0].Synonyms)
+	assert.Equal(t, []string{"hound"}, def.Translations[0].Meanings)
+	assert.Equal(t, []*Example{{Text: "barking dog", Translations: []string{"bellender Hund"}}}, def.Translations[0].Examples)
+
+	resp, err = c.lookup(context.Background(), "black dog", "en", "de")
+	require.NoError(t, err)
+	assert.Equal(t, StatusTranslation, resp.Status)
+	assert.Equal(t, ModeTranslation, resp.Mode)
+	assert.Equal(t, []string{"schwarzer Hund"}, resp.Translations)
+	assert.Empty(t, resp.Definitions)
+	for _, lang := range []string{"de", "fr"} {
+		resp, err = c.lookup(context.Background(), "cat", "en", lang)
+		require.NoError(t, err)
+		assert.Equal(t, StatusNotFound, resp.Status)
+		assert.Empty(t, resp.Translations)
+	}
+}
+
+func Test_Client_lookup_mode(t *testing.T) {
+	c := newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, &yandexTranslator{api: &translatorMock{}}, Options{MTOnly: true})
+
+	// the dictionary article is not used
+	resp, err := c.lookup(context.Background(), "dog", "en", "de")
+	require.NoError(t, err)
+	assert.Equal(t, StatusNotFound, resp.Status)
+	assert.Equal(t, "mock", resp.Provider)
+
+	// as well as the machine translation
+	c.opts.MTOnly, c.opts.DictOnly = false, true
+	resp, err = c.lookup(context.Background(), "black dog", "en", "de")
+	require.NoError(t, err)
+	assert.Equal(t, StatusNotFound, resp.Status)
+	resp, err = c.lookup(context.Background(), "dog", "en", "de")
+	require.NoError(t, err)
+	assert.Equal(t, StatusDictionary, resp.Status)
+	assert.Equal(t, ModeDictionary, resp.Mode)
+}
+
+func Test_Client_lookup_dictionaryOptions(t *testing.T) {
+	api := &recordingDictionaryAPI{yandexDictionaryAPI: &dictionaryMock{}}
+	c := newTestClient(t, &yandexDictionary{api: api}, nil, Options{Morpho: true, PosFilter: true})
+
+	_, err := c.lookup(context.Background(), "dog", "en", "de")
+	require.NoError(t, err)
+	assert.Equal(t, &yd.Params{Lang: "en-de", Text: "dog", Morpho: true, PosFilter: true}, api.params)
+}
+
+func Test_Client_lookup_errors(t *testing.T) {
+	tr := &failingTranslator{err: &APIError{Kind: ErrRequest, Err: errors.New("(422) can't translate")}}
+	c := newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, tr, Options{})
+
+	// errors specific to the request are reported in the response
+	resp, err := c.lookup(context.Background(), "cat", "en", "de")
+	require.NoError(t, err)
+	assert.Equal(t, StatusError, resp.Status)
+	assert.Equal(t, "(422) can't translate", resp.Error)
+	assert.Empty(t, resp.Translations)
+
+	// the error of the dictionary matters only if there is no translator
+	c.translator = nil
+	resp, err = c.lookup(context.Background(), "cat", "en", "de")
+	require.NoError(t, err)
+	assert.Equal(t, StatusNotFound, resp.Status)
+	c.translator = tr
+
+	tr.err = &APIError{Kind: ErrFatal, Err: errors.New("(401) API key is invalid")}
+	_, err = c.lookup(context.Background(), "cat", "en", "de")
+	assert.EqualError(t, err, "(401) API key is invalid")
+	// the dictionary response doesn't need the translator
+	_, err = c.lookup(context.Background(), "dog", "en", "de")
+	assert.NoError(t, err)
+}
+
+func Test_Client_detect(t *testing.T) {
+	c := newTestClient(t, nil, &yandexTranslator{api: &translatorMock{}}, Options{})
+	for req, expected := range map[string]string{"Hund": "de", "xyz": ""} {
+		lang, err := c.detect(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, lang)
+	}
+
+	// translator which can't detect languages detects them itself
+	c = newTestClient(t, nil, &countingTranslator{Translator: c.translator}, Options{Retries: 1})
+	lang, err := c.detect(context.Background(), "Hund")
+	require.NoError(t, err)
+	assert.Equal(t, "", lang)
+
+	c = newTestClient(t, nil, &failingTranslator{err: &APIError{Kind: ErrTransient, Err: errors.New("(503) unavailable")}}, Options{})
+	_, err = c.detect(context.Background(), "Hund")
+	assert.Error(t, err)
+}
+
+func Test_Client_Lookup(t *testing.T) {
+	c := newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, &yandexTranslator{api: &translatorMock{}}, Options{Jobs: 2})
+
+	e, err := c.Lookup(context.Background(), "dog", "en", []string{"de", "en"})
+	require.NoError(t, err)
+	assert.Equal(t, "dog", e.Request)
+	assert.Equal(t, "en", e.From)
+	assert.False(t, e.Detected)
+	// the target language equal to the source one is skipped
+	require.Len(t, e.Responses, 1)
+	assert.Equal(t, []string{"Hund", "Rüde", "geiler Bock"}, e.Responses[0].Translations)
+
+	// the source language is detected
+	e, err = c.Lookup(context.Background(), "Hund", AutoLang, []string{"de", "en"})
+	require.NoError(t, err)
+	assert.Equal(t, "de", e.From)
+	assert.True(t, e.Detected)
+	require.Len(t, e.Responses, 1)
+	assert.Equal(t, "en", e.Responses[0].Lang)
+	assert.Equal(t, []string{"dog"}, e.Responses[0].Translations)
+
+	// if the language can't be detected, the request is looked up for all languages
+	e, err = c.Lookup(context.Background(), "xyz", "", []string{"de", "en"})
+	require.NoError(t, err)
+	assert.Equal(t, "", e.From)
+	assert.False(t, e.Detected)
+	assert.Len(t, e.Responses, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Lookup(ctx, "dog", "en", []string{"de"})
+	assert.Equal(t, context.Canceled, err)
+
+	c.translator = &failingTranslator{err: &APIError{Kind: ErrFatal, Err: errors.New("(401) API key is invalid")}}
+	_, err = c.Lookup(context.Background(), "cat", "en", []string{"de"})
+	assert.EqualError(t, err, "(401) API key is invalid")
+}
+
+// blockingDictionary blocks lookups until the context is done, like the dictionary waiting for the slow server
+type blockingDictionary struct{}
+
+func (d *blockingDictionary) Lookup(ctx context.Context, params *Params) ([]*Definition, error) {
+	<-ctx.Done()
+	return nil, errors.Wrapf(ctx.Err(), "can't get definitions for %s", params.Text)
+}
+
+func Test_Client_Lookup_cancel(t *testing.T) {
+	c := newTestClient(t, &blockingDictionary{}, nil, Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	// calls to the provider are interrupted, the context error is returned instead of their errors
+	_, err := c.Lookup(ctx, "dog", "en", []string{"de", "it"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func Test_Client_LookupEntry(t *testing.T) {
+	c := newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, &yandexTranslator{api: &translatorMock{}}, Options{})
+
+	e := &Entry{Request: "dog", From: "en", Line: 3, Meta: map[string]string{"note": "pet"}}
+	require.NoError(t, c.LookupEntry(context.Background(), e, []string{"de", "it"}))
+	assert.Equal(t, 3, e.Line)
+	require.Len(t, e.Responses, 2)
+	assert.Equal(t, "de", e.Responses[0].Lang)
+	assert.Equal(t, "it", e.Responses[1].Lang)
+	assert.Equal(t, StatusNotFound, e.Responses[1].Status)
+}
+
+func Test_Client_LookupBatch(t *testing.T) {
+	c := newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, &yandexTranslator{api: &translatorMock{}}, Options{Jobs: 4})
+
+	var texts []string
+	for i := 0; i < 20; i++ {
+		texts = append(texts, fmt.Sprintf("word %d", i), "dog")
+	}
+	entries, err := c.LookupBatch(context.Background(), texts, "en", []string{"de", "it"})
+	require.NoError(t, err)
+	require.Len(t, entries, len(texts))
+	for i, e := range entries {
+		assert.Equal(t, texts[i], e.Request)
+		assert.Len(t, e.Responses, 2)
+	}
+	assert.Equal(t, StatusDictionary, entries[1].Responses[0].Status)
+
+	entries, err = c.LookupBatch(context.Background(), nil, "en", []string{"de"})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// calls of the failing translator are serialized, it isn't safe for concurrent use
+	tr := &failingTranslator{err: &APIError{Kind: ErrFatal, Err: errors.New("(401) API key is invalid")}}
+	c = newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, tr, Options{})
+	_, err = c.LookupBatch(context.Background(), texts, "en", []string{"de"})
+	assert.EqualError(t, err, "(401) API key is invalid")
+}
+
+func Test_Client_Languages(t *testing.T) {
+	c := newTestClient(t, nil, &yandexTranslator{api: &translatorMock{}}, Options{})
+
+	_, err := c.Languages(context.Background(), "")
+	require.Error(t, err)
+
+	langs, err := c.Languages(context.Background(), "en")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"en": "english", "de": "german", "it": "italian"}, langs.Names)
+
+	c = newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, nil, Options{})
+	_, err = c.Languages(context.Background(), "en")
+	assert.EqualError(t, err, "provider mock can't list supported languages")
+}
+
+func Test_Client_Dirs(t *testing.T) {
+	c := newTestClient(t, &yandexDictionary{api: &dictionaryMock{}}, &yandexTranslator{api: &translatorMock{}}, Options{})
+	dirs, err := c.Dirs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"en-de", "de-en"}, dirs)
+
+	// the dictionary is not used for the machine translation only lookups
+	c.opts.MTOnly = true
+	dirs, err = c.Dirs(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, dirs)
+
+	c = newTestClient(t, nil, &yandexTranslator{api: &translatorMock{}}, Options{})
+	dirs, err = c.Dirs(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, dirs)
+}
@@ -0,0 +1,227 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DICT protocol (RFC 2229) response codes
+const (
+	dictCodeBanner      = 220
+	dictCodeDefinitions = 150
+	dictCodeDefinition  = 151
+	dictCodeOK          = 250
+	dictCodeNoMatch     = 552
+	// server temporarily unavailable and shutting down
+	dictCodeUnavailable = 420
+	dictCodeShutdown    = 421
+	// access denied
+	dictCodeDenied     = 530
+	dictCodeAuthDenied = 531
+)
+
+// iso6393 maps two letter language codes to three letter ones used in FreeDict database names
+var iso6393 = map[string]string{
+	"cs": "ces", "da": "dan", "de": "deu", "el": "ell", "en": "eng", "es": "spa", "fi": "fin",
+	"fr": "fra", "ga": "gle", "hu": "hun", "it": "ita", "ja": "jpn", "la": "lat", "nl": "nld",
+	"no": "nor", "pl": "pol", "pt": "por", "ru": "rus", "sv": "swe", "tr": "tur", "uk": "ukr",
+}
+
+var (
+	// dictTranscriptionRe matches transcription, e.g. /dɒɡ/
+	dictTranscriptionRe = regexp.MustCompile(`/([^/]+)/`)
+	// dictPosRe matches part of speech, e.g. <n>
+	dictPosRe = regexp.MustCompile(`<([^>]+)>`)
+	// dictNumberRe matches numbering of translations, e.g. 1.
+	dictNumberRe = regexp.MustCompile(`^\d+\.\s*`)
+)
+
+// NewDictd creates the provider using DICT protocol server, e.g. dictd with FreeDict databases installed.
+// Databases map translation directions to database names, e.g. en-de to fd-eng-deu,
+// the FreeDict ones are used for other directions.
+// DICT servers have no machine translation, so it provides the dictionary only
+func NewDictd(addr string, databases map[string]string) *Provider {
+	return &Provider{Name: "dictd", Dictionary: &dictdDictionary{addr: addr, databases: databases, timeout: 10 * time.Second}}
+}
+
+// dictdDictionary implements Dictionary interface using DICT protocol server
+type dictdDictionary struct {
+	addr string
+	// databases maps translation directions to database names
+	databases map[string]string
+	timeout   time.Duration
+}
+
+func (d *dictdDictionary) Lookup(ctx context.Context, params *Params) ([]*Definition, error) {
+	errMsg := fmt.Sprintf("can't get definitions for %s", params.Text)
+
+	db, err := d.database(params.From, params.To)
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	conn, err := (&net.Dialer{Timeout: d.timeout}).DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+	conn.SetDeadline(time.Now().Add(d.timeout))
+	c := textproto.NewConn(conn)
+	defer c.Close()
+
+	// the deadline in the past interrupts the exchange with the server when the context is done
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-finished:
+		}
+	}()
+
+	if _, _, err = c.ReadCodeLine(dictCodeBanner); err != nil {
+		if tpErr, ok := err.(*textproto.Error); ok {
+			err = dictError(tpErr.Code, tpErr.Msg)
+		}
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	defs, err := d.define(c, db, params.Text)
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+	c.PrintfLine("QUIT")
+
+	if len(defs) == 0 {
+		return nil, errors.Errorf("%s: definitions are empty", errMsg)
+	}
+	return defs, nil
+}
+
+// define sends DEFINE command to the server and parses definitions it returns
+func (d *dictdDictionary) define(c *textproto.Conn, db, word string) ([]*Definition, error) {
+	if err := c.PrintfLine("DEFINE %s %s", db, dictQuote(word)); err != nil {
+		return nil, err
+	}
+
+	code, msg, err := c.ReadCodeLine(0)
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case dictCodeDefinitions:
+	case dictCodeNoMatch:
+		return nil, nil
+	default:
+		return nil, dictError(code, msg)
+	}
+
+	var defs []*Definition
+	for {
+		code, msg, err := c.ReadCodeLine(0)
+		if err != nil {
+			return nil, err
+		}
+		if code == dictCodeOK {
+			return defs, nil
+		}
+		if code != dictCodeDefinition {
+			return nil, dictError(code, msg)
+		}
+
+		lines, err := c.ReadDotLines()
+		if err != nil {
+			return nil, err
+		}
+		if def := parseDictDefinition(lines); def != nil {
+			defs = append(defs, def)
+		}
+	}
+}
+
+// database returns name of the database for the translation direction,
+// it is either specified explicitly or the FreeDict one, e.g. fd-eng-deu for en-de
+func (d *dictdDictionary) database(from, to string) (string, error) {
+	if db, ok := d.databases[from+"-"+to]; ok {
+		return db, nil
+	}
+
+	f, fromOK := iso6393[from]
+	t, toOK := iso6393[to]
+	if !fromOK || !toOK {
+		return "", errors.Errorf("no DICT database for %s-%s", from, to)
+	}
+	return "fd-" + f + "-" + t, nil
+}
+
+// parseDictDefinition parses FreeDict style definition text,
+// with the headword, transcription and part of speech on the first line and translations on the next ones
+func parseDictDefinition(lines []string) *Definition {
+	var def *Definition
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if def == nil {
+			def = &Definition{}
+			if m := dictTranscriptionRe.FindStringSubmatch(line); m != nil {
+				def.Transcription = m[1]
+				line = strings.Replace(line, m[0], "", 1)
+			}
+			def.Pos, def.Text = extractDictPos(line)
+			continue
+		}
+
+		line = dictNumberRe.ReplaceAllString(line, "")
+		for _, text := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ';' }) {
+			tr := &Translation{}
+			tr.Pos, tr.Text = extractDictPos(text)
+			if tr.Text != "" {
+				def.Translations = append(def.Translations, tr)
+			}
+		}
+	}
+
+	if def == nil || len(def.Translations) == 0 {
+		return nil
+	}
+	return def
+}
+
+// extractDictPos returns part of speech, e.g. n for <n>, and the text without it
+func extractDictPos(text string) (string, string) {
+	var pos string
+	if m := dictPosRe.FindStringSubmatch(text); m != nil {
+		pos = m[1]
+		text = strings.Replace(text, m[0], "", 1)
+	}
+	return pos, strings.Join(strings.Fields(text), " ")
+}
+
+// dictError classifies the error response of the DICT server by its code
+func dictError(code int, msg string) error {
+	kind := ErrRequest
+	switch code {
+	case dictCodeUnavailable, dictCodeShutdown:
+		kind = ErrTransient
+	case dictCodeDenied, dictCodeAuthDenied:
+		kind = ErrFatal
+	}
+	return &APIError{Kind: kind, Code: code, Err: errors.Errorf("(%d) %s", code, msg)}
+}
+
+// dictQuote quotes the word according to the DICT protocol
+func dictQuote(word string) string {
+	word = strings.Replace(word, `\`, `\\`, -1)
+	word = strings.Replace(word, `"`, `\"`, -1)
+	return `"` + word + `"`
+}
@@ -0,0 +1,111 @@
+package lookup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDictServer starts the local stand-in for the DICT protocol server and returns its address
+func newDictServer(t *testing.T) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveDict(conn)
+		}
+	}()
+
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func serveDict(conn net.Conn) {
+	defer conn.Close()
+	w := bufio.NewWriter(conn)
+	r := bufio.NewReader(conn)
+
+	fmt.Fprint(w, "220 dictd stand-in <auth.mime> <1@localhost>\r\n")
+	w.Flush()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "QUIT":
+			fmt.Fprint(w, "221 bye\r\n")
+			w.Flush()
+			return
+		case fields[0] == "DEFINE" && fields[1] != "fd-eng-deu" && fields[1] != "custom":
+			fmt.Fprint(w, "550 invalid database\r\n")
+		case fields[0] == "DEFINE" && fields[2] == `"dog"`:
+			fmt.Fprint(w, "150 1 definitions retrieved\r\n")
+			fmt.Fprint(w, "151 \"dog\" fd-eng-deu \"English-German FreeDict Dictionary\"\r\n")
+			fmt.Fprint(w, "dog /dɒɡ/ <n>\r\n 1. Hund <m>; Rüde\r\n 2. geiler Bock\r\n.\r\n")
+			fmt.Fprint(w, "250 ok\r\n")
+		default:
+			fmt.Fprint(w, "552 no match\r\n")
+		}
+		w.Flush()
+	}
+}
+
+func Test_NewDictd(t *testing.T) {
+	p := NewDictd("localhost:2628", map[string]string{"en-de": "custom"})
+	assert.Equal(t, "dictd", p.Name)
+	assert.Nil(t, p.Translator)
+	assert.Equal(t, map[string]string{"en-de": "custom"}, p.Dictionary.(*dictdDictionary).databases)
+}
+
+func Test_dictdDictionary_Lookup(t *testing.T) {
+	addr, stop := newDictServer(t)
+	defer stop()
+
+	p := NewDictd(addr, nil)
+	defs, err := p.Dictionary.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "dog"})
+	require.NoError(t, err)
+	require.Len(t, defs, 1)
+	assert.Equal(t, &Definition{
+		Text:          "dog",
+		Pos:           "n",
+		Transcription: "dɒɡ",
+		Translations:  []*Translation{{Text: "Hund", Pos: "m"}, {Text: "Rüde"}, {Text: "geiler Bock"}},
+	}, defs[0])
+
+	_, err = p.Dictionary.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "cat"})
+	assert.EqualError(t, err, "can't get definitions for cat: definitions are empty")
+
+	_, err = p.Dictionary.Lookup(context.Background(), &Params{From: "en", To: "xx", Text: "dog"})
+	assert.EqualError(t, err, "can't get definitions for dog: no DICT database for en-xx")
+
+	_, err = p.Dictionary.Lookup(context.Background(), &Params{From: "en", To: "fr", Text: "dog"})
+	assert.EqualError(t, err, "can't get definitions for dog: (550) invalid database")
+
+	p = NewDictd(addr, map[string]string{"en-de": "custom"})
+	defs, err = p.Dictionary.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "dog"})
+	require.NoError(t, err)
+	assert.Len(t, defs, 1)
+
+	stop()
+	d := p.Dictionary.(*dictdDictionary)
+	d.timeout = 100 * time.Millisecond
+	_, err = d.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "dog"})
+	assert.Error(t, err)
+}
+
+func Test_dictQuote(t *testing.T) {
+	assert.Equal(t, `"black \"dog\" \\"`, dictQuote(`black "dog" \`))
+}
@@ -0,0 +1,20 @@
+/*
+Package lookup looks words and phrases up in online dictionaries, falling back to the machine translation
+if there is no dictionary article, and renders results as text, html, JSON, CSV or Anki cards.
+
+The Client uses the Provider, which bundles the dictionary and the translator of the single translation service,
+e.g. the one created by NewYandex, NewLibreTranslate or NewDictd. Other services can be plugged in
+by implementing Dictionary and Translator interfaces:
+
+	c, err := lookup.New(lookup.NewLibreTranslate("http://localhost:5000", ""), lookup.Options{Jobs: 4})
+	if err != nil {
+		return err
+	}
+	e, err := c.Lookup(ctx, "dog", lookup.AutoLang, []string{"de", "it"})
+
+Errors specific to the request, e.g. the unsupported direction, are reported in responses of the entry,
+other ones, e.g. the invalid API key or the network failure, are returned. KindOf tells them apart.
+
+Results are rendered by renderers returned by NewRenderer or by TemplateRenderer using custom templates.
+*/
+package lookup
@@ -0,0 +1,133 @@
+package lookup
+
+import "encoding/json"
+
+// Entry holds request and corresponding responses, one for each specified language
+type Entry struct {
+	Request string `json:"request"`
+	// Line is the number of the source line, the first one for repeated requests
+	Line int `json:"line,omitempty"`
+	// Count is the number of occurrences of the request in the data source
+	Count int `json:"count,omitempty"`
+	// LastLine is the number of the source line of the last occurrence of the request
+	LastLine int `json:"last_line,omitempty"`
+	// Context is the source line containing the request, if the request is its part, e.g. the single word
+	Context string `json:"context,omitempty"`
+	// Meta holds other columns or fields of the structured source file, e.g. notes or tags
+	Meta map[string]string `json:"meta,omitempty"`
+	// From is the source language, specified or detected
+	From string `json:"from"`
+	// Detected is set if the source language is detected automatically
+	Detected  bool        `json:"detected,omitempty"`
+	Responses []*Response `json:"responses"`
+}
+
+// Response holds the single response
+type Response struct {
+	Lang   string `json:"lang"`
+	Status Status `json:"status"`
+	// Error holds the message of the provider error if the status is error
+	Error string `json:"error,omitempty"`
+	// Provider is the name of the provider which looked the request up
+	Provider string `json:"provider,omitempty"`
+	// Mode tells which service of the provider produced translations or the error
+	Mode Mode `json:"mode,omitempty"`
+	// Translations is the flat list of all translations, used for the short output
+	Translations []string `json:"translations"`
+	// Definitions holds the full dictionary articles, it is empty for machine translations
+	Definitions []*Definition `json:"definitions,omitempty"`
+}
+
+// Status tells where translations of the response come from or why there are no ones
+type Status string
+
+const (
+	// StatusDictionary means that translations are taken from the dictionary article
+	StatusDictionary Status = "dictionary"
+	// StatusTranslation means that there is no dictionary article and the request is machine translated
+	StatusTranslation Status = "translation"
+	// StatusNotFound means that neither dictionary nor translator know the request
+	StatusNotFound Status = "not_found"
+	// StatusError means that the provider failed to look the request up, e.g. the direction is not supported
+	StatusError Status = "error"
+)
+
+// Mode is the service of the provider, which produced the response
+type Mode string
+
+const (
+	ModeDictionary  Mode = "dictionary"
+	ModeTranslation Mode = "translation"
+)
+
+// setError sets the error status if the provider reported the error for the request,
+// other errors, e.g. empty definitions, mean that the request is not found
+func (r *Response) setError(err error, mode Mode) {
+	if e := findAPIError(err); e != nil {
+		r.Status, r.Error, r.Mode = StatusError, e.Error(), mode
+	}
+}
+
+// MarshalJSON encodes the response with the empty list of translations rather than null,
+// if the request is not found or the lookup failed
+func (r Response) MarshalJSON() ([]byte, error) {
+	type response Response
+	v := response(r)
+	if v.Translations == nil {
+		v.Translations = []string{}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes the response, the empty list of translations is decoded as nil,
+// so decoded responses are the same as looked up ones
+func (r *Response) UnmarshalJSON(data []byte) error {
+	type response Response
+	var v response
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if len(v.Translations) == 0 {
+		v.Translations = nil
+	}
+	*r = Response(v)
+	return nil
+}
+
+// Found returns true if the response has translations
+func (r *Response) Found() bool {
+	return r.Status == StatusDictionary || r.Status == StatusTranslation
+}
+
+// Missing returns true if the request is not translated to some of languages
+func (e *Entry) Missing() bool {
+	for _, resp := range e.Responses {
+		if !resp.Found() {
+			return true
+		}
+	}
+	return false
+}
+
+// Definition is the dictionary article for the request used as a single part of speech
+type Definition struct {
+	Text          string         `json:"text"`
+	Pos           string         `json:"pos,omitempty"`
+	Transcription string         `json:"transcription,omitempty"`
+	Translations  []*Translation `json:"translations"`
+}
+
+// Translation holds the single dictionary translation along with its synonyms, meanings and usage examples
+type Translation struct {
+	Text     string     `json:"text"`
+	Pos      string     `json:"pos,omitempty"`
+	Synonyms []string   `json:"synonyms,omitempty"`
+	Meanings []string   `json:"meanings,omitempty"`
+	Examples []*Example `json:"examples,omitempty"`
+}
+
+// Example holds the usage example and its translations
+type Example struct {
+	Text         string   `json:"text"`
+	Translations []string `json:"translations"`
+}
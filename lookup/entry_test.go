@@ -0,0 +1,42 @@
+package lookup
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Entry_Missing(t *testing.T) {
+	e := &Entry{Request: "dog", Responses: []*Response{{Lang: "de", Status: StatusDictionary}, {Lang: "it", Status: StatusTranslation}}}
+	assert.False(t, e.Missing())
+	e.Responses = append(e.Responses, &Response{Lang: "fr", Status: StatusNotFound})
+	assert.True(t, e.Missing())
+	assert.False(t, (&Entry{}).Missing())
+}
+
+func Test_Response_MarshalJSON(t *testing.T) {
+	b, err := json.Marshal(&Response{Lang: "de", Status: StatusNotFound})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"lang":"de","status":"not_found","translations":[]}`, string(b))
+	var r Response
+	assert.NoError(t, json.Unmarshal(b, &r))
+	assert.Equal(t, Response{Lang: "de", Status: StatusNotFound}, r)
+
+	b, err = json.Marshal(Response{Lang: "de", Status: StatusDictionary, Translations: []string{"Hund"}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"lang":"de","status":"dictionary","translations":["Hund"]}`, string(b))
+}
+
+func Test_Response_setError(t *testing.T) {
+	r := &Response{Status: StatusNotFound}
+	r.setError(errors.New("definitions are empty"), ModeDictionary)
+	assert.Equal(t, StatusNotFound, r.Status)
+
+	r.setError(&APIError{Kind: ErrRequest, Code: 501, Err: errors.New("(501) The specified language is not supported")}, ModeTranslation)
+	assert.Equal(t, StatusError, r.Status)
+	assert.Equal(t, "(501) The specified language is not supported", r.Error)
+	assert.Equal(t, ModeTranslation, r.Mode)
+	assert.False(t, r.Found())
+}
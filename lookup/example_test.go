@@ -0,0 +1,77 @@
+package lookup_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// words is the example of the custom dictionary, which knows translations of a few words from English to German
+type words map[string][]string
+
+func (w words) Lookup(ctx context.Context, params *lookup.Params) ([]*lookup.Definition, error) {
+	trs, ok := w[params.Text]
+	if !ok || params.From != "en" || params.To != "de" {
+		return nil, errors.Errorf("no entry for %s", params.Text)
+	}
+	def := &lookup.Definition{Text: params.Text}
+	for _, tr := range trs {
+		def.Translations = append(def.Translations, &lookup.Translation{Text: tr})
+	}
+	return []*lookup.Definition{def}, nil
+}
+
+func Example() {
+	p := &lookup.Provider{Name: "words", Dictionary: words{"dog": {"Hund", "Rüde"}}}
+	c, err := lookup.New(p, lookup.Options{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	e, err := c.Lookup(context.Background(), "dog", "en", []string{"de"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, resp := range e.Responses {
+		fmt.Println(resp.Lang, resp.Status, resp.Translations)
+	}
+	// Output: de dictionary [Hund Rüde]
+}
+
+func ExampleClient_LookupBatch() {
+	p := &lookup.Provider{Name: "words", Dictionary: words{"dog": {"Hund", "Rüde"}, "cat": {"Katze"}}}
+	c, err := lookup.New(p, lookup.Options{Jobs: 4})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	entries, err := c.LookupBatch(context.Background(), []string{"dog", "cat", "pig"}, "en", []string{"de"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, e := range entries {
+		fmt.Println(e.Request, e.Responses[0].Status, e.Responses[0].Translations)
+	}
+	// Output:
+	// dog dictionary [Hund Rüde]
+	// cat dictionary [Katze]
+	// pig not_found []
+}
+
+func ExampleNewRenderer() {
+	e := &lookup.Entry{Request: "black dog", From: "en", Responses: []*lookup.Response{
+		{Lang: "de", Status: lookup.StatusTranslation, Translations: []string{"schwarzer Hund"}},
+	}}
+	r := lookup.NewRenderer("csv")
+	if err := r.Render(os.Stdout, []*lookup.Entry{e}); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// request,from,lang,status,transcription,pos,translations,meta
+	// black dog,en,de,translation,,,schwarzer Hund,
+}
@@ -0,0 +1,142 @@
+package lookup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewLibreTranslate creates the provider using LibreTranslate compatible server,
+// the API key is needed only if the server requires it.
+// LibreTranslate has no dictionary, so it provides the translator only
+func NewLibreTranslate(url, apiKey string) *Provider {
+	t := &libreTranslator{
+		url:    strings.TrimRight(url, "/"),
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	return &Provider{Name: "libretranslate", Translator: t}
+}
+
+// libreTranslator implements Translator interface using LibreTranslate API
+type libreTranslator struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// libreLanguage is the single element of the LibreTranslate languages list
+type libreLanguage struct {
+	Code    string   `json:"code"`
+	Name    string   `json:"name"`
+	Targets []string `json:"targets"`
+}
+
+func (t *libreTranslator) Translate(ctx context.Context, params *Params) (string, error) {
+	errMsg := fmt.Sprintf("can't get translation for %s", params.Text)
+
+	source := params.From
+	if source == "" {
+		source = "auto"
+	}
+	req := map[string]string{"q": params.Text, "source": source, "target": params.To, "format": "text"}
+	if t.apiKey != "" {
+		req["api_key"] = t.apiKey
+	}
+
+	var resp struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := t.call(ctx, http.MethodPost, "/translate", req, &resp); err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+	return resp.TranslatedText, nil
+}
+
+// Detect returns the most probable language of the text
+func (t *libreTranslator) Detect(ctx context.Context, text string) (string, error) {
+	req := map[string]string{"q": text}
+	if t.apiKey != "" {
+		req["api_key"] = t.apiKey
+	}
+
+	var resp []struct {
+		Confidence float64 `json:"confidence"`
+		Language   string  `json:"language"`
+	}
+	if err := t.call(ctx, http.MethodPost, "/detect", req, &resp); err != nil {
+		return "", errors.Wrapf(err, "can't detect language of %s", text)
+	}
+
+	lang, confidence := "", -1.0
+	for _, r := range resp {
+		if r.Confidence > confidence {
+			lang, confidence = r.Language, r.Confidence
+		}
+	}
+	if lang == "" {
+		return "", errors.Errorf("can't detect language of %s", text)
+	}
+	return lang, nil
+}
+
+// GetLangs returns the supported languages, LibreTranslate has no localized names, so ui is ignored
+func (t *libreTranslator) GetLangs(ctx context.Context, ui string) (*Languages, error) {
+	var resp []libreLanguage
+	if err := t.call(ctx, http.MethodGet, "/languages", nil, &resp); err != nil {
+		return nil, errors.Wrap(err, "can't get supported languages")
+	}
+
+	langs := &Languages{Names: make(map[string]string, len(resp))}
+	for _, l := range resp {
+		langs.Names[l.Code] = l.Name
+		for _, target := range l.Targets {
+			if target != l.Code {
+				langs.Dirs = append(langs.Dirs, l.Code+"-"+target)
+			}
+		}
+	}
+	return langs, nil
+}
+
+// call makes request to the LibreTranslate API, encoding body and decoding response as JSON,
+// the request is cancelled when the context is done
+func (t *libreTranslator) call(ctx context.Context, method, path string, body interface{}, v interface{}) error {
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, t.url+path, &b)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		err = errors.Errorf("(%d) %s", resp.StatusCode, e.Error)
+		return &APIError{Kind: httpErrorKind(resp.StatusCode), Code: resp.StatusCode, Err: err}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,100 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLibreTranslateServer returns the local stand-in for the LibreTranslate server
+func newLibreTranslateServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/languages":
+			w.Write([]byte(`[{"code":"en","name":"English","targets":["de","en"]},{"code":"de","name":"German","targets":["en"]}]`))
+		case "/translate":
+			var req map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if req["api_key"] != "secret" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error":"Invalid API key"}`))
+				return
+			}
+			if req["q"] == "black dog" && req["target"] == "de" && (req["source"] == "en" || req["source"] == "auto") {
+				w.Write([]byte(`{"translatedText":"schwarzer Hund"}`))
+				return
+			}
+			w.Write([]byte(`{"translatedText":"` + req["q"] + `"}`))
+		case "/detect":
+			var req map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if req["q"] == "Hund" {
+				w.Write([]byte(`[{"confidence":40,"language":"nl"},{"confidence":90,"language":"de"}]`))
+				return
+			}
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func Test_NewLibreTranslate(t *testing.T) {
+	p := NewLibreTranslate("http://localhost:5000/", "")
+	assert.Equal(t, "libretranslate", p.Name)
+	assert.Nil(t, p.Dictionary)
+	assert.Equal(t, "http://localhost:5000", p.Translator.(*libreTranslator).url)
+}
+
+func Test_libreTranslator_Translate(t *testing.T) {
+	ts := newLibreTranslateServer(t)
+	defer ts.Close()
+
+	p := NewLibreTranslate(ts.URL, "secret")
+	result, err := p.Translator.Translate(context.Background(), &Params{From: "en", To: "de", Text: "black dog"})
+	require.NoError(t, err)
+	assert.Equal(t, "schwarzer Hund", result)
+
+	result, err = p.Translator.Translate(context.Background(), &Params{To: "de", Text: "black dog"})
+	require.NoError(t, err)
+	assert.Equal(t, "schwarzer Hund", result)
+
+	p = NewLibreTranslate(ts.URL, "")
+	_, err = p.Translator.Translate(context.Background(), &Params{From: "en", To: "de", Text: "black dog"})
+	assert.EqualError(t, err, "can't get translation for black dog: (403) Invalid API key")
+	assert.Equal(t, ErrFatal, KindOf(err))
+}
+
+func Test_libreTranslator_GetLangs(t *testing.T) {
+	ts := newLibreTranslateServer(t)
+	defer ts.Close()
+
+	p := NewLibreTranslate(ts.URL, "")
+	langs, err := p.Translator.GetLangs(context.Background(), "en")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"en": "English", "de": "German"}, langs.Names)
+	assert.Equal(t, []string{"en-de", "de-en"}, langs.Dirs)
+
+	ts.Close()
+	_, err = p.Translator.GetLangs(context.Background(), "en")
+	assert.Error(t, err)
+}
+
+func Test_libreTranslator_Detect(t *testing.T) {
+	ts := newLibreTranslateServer(t)
+	defer ts.Close()
+
+	p := NewLibreTranslate(ts.URL, "")
+	d := p.Translator.(Detector)
+	lang, err := d.Detect(context.Background(), "Hund")
+	require.NoError(t, err)
+	assert.Equal(t, "de", lang)
+
+	_, err = d.Detect(context.Background(), "xyz")
+	assert.EqualError(t, err, "can't detect language of xyz")
+}
@@ -0,0 +1,70 @@
+package lookup
+
+import (
+	yd "github.com/dafanasev/go-yandex-dictionary"
+	yt "github.com/dafanasev/go-yandex-translate"
+	"github.com/pkg/errors"
+)
+
+// newMockProvider creates the provider using Yandex API mocks, which know only a few requests, e.g. dog for en-de
+func newMockProvider() *Provider {
+	return &Provider{
+		Name:       "mock",
+		Dictionary: &yandexDictionary{api: &dictionaryMock{}},
+		Translator: &yandexTranslator{api: &translatorMock{}},
+	}
+}
+
+// dictionaryMock is the mock for the yandexDictionaryAPI interface
+type dictionaryMock struct{}
+
+func (m *dictionaryMock) Lookup(params *yd.Params) (*yd.Entry, error) {
+	if params.Text == "dog" && params.Lang == "en-de" {
+		var trs1 []yd.Tr
+		trs1 = append(trs1, yd.Tr{
+			Text: "Hund",
+			Pos:  "noun",
+			Syn:  []yd.Text{{Text: "Köter"}},
+			Mean: []yd.Text{{Text: "hound"}},
+			Ex:   []yd.Ex{{Text: "barking dog", Tr: []yd.Text{{Text: "bellender Hund"}}}},
+		})
+		trs1 = append(trs1, yd.Tr{Text: "Rüde", Pos: "noun"})
+
+		trs2 := []yd.Tr{{Text: "geiler Bock", Pos: "noun"}}
+
+		defs := []yd.Def{{Text: "dog", Pos: "noun", Ts: "dɒg", Tr: trs1}, {Text: "dog", Pos: "noun", Tr: trs2}}
+		return &yd.Entry{Def: defs}, nil
+	}
+	return nil, errors.New("no entry")
+}
+
+func (m *dictionaryMock) GetLangs() ([]string, error) {
+	return []string{"en-de", "de-en"}, nil
+}
+
+// translatorMock is the mock for the yandexTranslatorAPI interface
+type translatorMock struct{}
+
+func (m *translatorMock) Translate(lang, text string) (*yt.Response, error) {
+	if text == "black dog" && (lang == "de" || lang == "en-de") {
+		return &yt.Response{Lang: "en-de", Text: []string{"schwarzer Hund"}, Detected: map[string]string{"lang": "en"}}, nil
+	}
+	if text == "Hund" && (lang == "en" || lang == "de-en") {
+		return &yt.Response{Lang: "de-en", Text: []string{"dog"}, Detected: map[string]string{"lang": "de"}}, nil
+	}
+	// only the target language is specified when the source one should be detected
+	if (text == "dog" || text == "cat") && lang == "en" {
+		return &yt.Response{Lang: "en-en", Text: []string{text}, Detected: map[string]string{"lang": "en"}}, nil
+	}
+	return nil, errors.New("no translation")
+}
+
+func (m *translatorMock) GetLangs(ui string) (*yt.Languages, error) {
+	if ui == "en" {
+		return &yt.Languages{
+			Langs: map[string]string{"en": "english", "de": "german", "it": "italian"},
+			Dirs:  []string{"en-de", "en-it", "de-en", "de-it", "it-en", "it-de"},
+		}, nil
+	}
+	return nil, errors.New("wrong lang")
+}
@@ -0,0 +1,79 @@
+package lookup
+
+import (
+	"context"
+	"strings"
+)
+
+// Provider bundles dictionary and translator of the single translation service.
+// Either of them can be nil if the service doesn't support it
+type Provider struct {
+	// Name is used to tell responses of different providers apart, e.g. in the cache
+	Name       string
+	Dictionary Dictionary
+	Translator Translator
+}
+
+// Dictionary defines provider neutral interface to look up dictionary articles.
+// Methods of all provider interfaces should return as soon as possible when the context is done
+type Dictionary interface {
+	Lookup(ctx context.Context, params *Params) ([]*Definition, error)
+}
+
+// Translator defines provider neutral interface to get machine translations and supported languages
+type Translator interface {
+	Translate(ctx context.Context, params *Params) (string, error)
+	GetLangs(ctx context.Context, ui string) (*Languages, error)
+}
+
+// Detector is the optional interface of translators that can detect the language of the text
+type Detector interface {
+	Detect(ctx context.Context, text string) (string, error)
+}
+
+// DirsLister is the optional interface of dictionaries which can list translation directions they support.
+// Nil list means that supported directions are unknown
+type DirsLister interface {
+	GetDirs(ctx context.Context) ([]string, error)
+}
+
+// Params holds parameters of dictionary and translator requests
+type Params struct {
+	From string
+	To   string
+	Text string
+	// UI is the language of the dictionary interface, e.g. names of parts of speech
+	UI string
+	// Family turns on the family filter, excluding obscene words
+	Family bool
+	// Morpho turns on the search by word forms, e.g. dog for dogs
+	Morpho bool
+	// PosFilter keeps translations having the same part of speech as the request
+	PosFilter bool
+}
+
+// dictionaryOptions returns the string describing dictionary options which differ from the default ones,
+// it is empty if there are no ones
+func (p *Params) dictionaryOptions() string {
+	var opts []string
+	if p.UI != "" {
+		opts = append(opts, "ui="+p.UI)
+	}
+	for _, o := range []struct {
+		name string
+		on   bool
+	}{{"family", p.Family}, {"morpho", p.Morpho}, {"pos-filter", p.PosFilter}} {
+		if o.on {
+			opts = append(opts, o.name)
+		}
+	}
+	return strings.Join(opts, ",")
+}
+
+// Languages holds languages supported by the provider
+type Languages struct {
+	// Names maps language codes to language names
+	Names map[string]string
+	// Dirs holds supported translation directions, e.g. en-de
+	Dirs []string
+}
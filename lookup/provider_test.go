@@ -0,0 +1,13 @@
+package lookup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Params_dictionaryOptions(t *testing.T) {
+	assert.Equal(t, "", (&Params{From: "en", To: "de", Text: "dog"}).dictionaryOptions())
+	assert.Equal(t, "ui=ru,family,pos-filter", (&Params{UI: "ru", Family: true, PosFilter: true}).dictionaryOptions())
+	assert.Equal(t, "morpho", (&Params{Morpho: true}).dictionaryOptions())
+}
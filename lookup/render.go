@@ -0,0 +1,254 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Renderer renders the list of lookup results
+type Renderer interface {
+	Render(w io.Writer, entries []*Entry) error
+}
+
+// EntryRenderer is the optional interface of renderers that can render lookup results one by one,
+// n is the number of the entry, starting from 1
+type EntryRenderer interface {
+	RenderEntry(w io.Writer, e *Entry, n int) error
+}
+
+// NewRenderer returns the renderer of the built-in format: text, html, json, jsonl, csv, tsv or anki,
+// or nil if there is no such format
+func NewRenderer(format string) Renderer {
+	switch format {
+	case "text":
+		return &TemplateRenderer{Templater: &TextTemplater{}}
+	case "html":
+		return &TemplateRenderer{Templater: &HTMLTemplater{}}
+	case "json":
+		return &JSONRenderer{}
+	case "jsonl":
+		return &JSONLRenderer{}
+	case "csv":
+		return &CSVRenderer{Comma: ','}
+	case "tsv":
+		return &CSVRenderer{Comma: '\t'}
+	case "anki":
+		return &AnkiRenderer{}
+	}
+	return nil
+}
+
+// TemplateRenderer implements Renderer interface using templater,
+// it renders the whole document, with layout if templater supports it
+type TemplateRenderer struct {
+	Templater Templater
+}
+
+func (r *TemplateRenderer) Render(w io.Writer, entries []*Entry) error {
+	text := r.Templater.Entry() + r.Templater.List()
+	// if templater supports layout, use it
+	if lt, ok := r.Templater.(LayoutTemplater); ok {
+		text += lt.Layout()
+	}
+	t, err := ParseTemplate(text)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	err = t.Execute(&b, struct{ Entries []*Entry }{entries})
+	if err != nil {
+		return errors.Wrap(err, "can't render template")
+	}
+
+	_, err = b.WriteTo(w)
+	return err
+}
+
+// JSONRenderer implements Renderer interface to render lookup results as the JSON array
+type JSONRenderer struct{}
+
+func (r *JSONRenderer) Render(w io.Writer, entries []*Entry) error {
+	if entries == nil {
+		entries = []*Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// JSONLRenderer implements Renderer and EntryRenderer interfaces to render lookup results as JSON Lines,
+// one JSON object for each entry
+type JSONLRenderer struct{}
+
+func (r *JSONLRenderer) Render(w io.Writer, entries []*Entry) error {
+	for i, e := range entries {
+		if err := r.RenderEntry(w, e, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *JSONLRenderer) RenderEntry(w io.Writer, e *Entry, n int) error {
+	return json.NewEncoder(w).Encode(e)
+}
+
+// CSVRenderer implements Renderer and EntryRenderer interfaces to render lookup results as CSV or TSV,
+// with header and one row for each response
+type CSVRenderer struct {
+	// Comma is the field delimiter, e.g. tab for TSV
+	Comma rune
+}
+
+// csvHeader holds names of CSV columns
+var csvHeader = []string{"request", "from", "lang", "status", "transcription", "pos", "translations", "meta"}
+
+func (r *CSVRenderer) Render(w io.Writer, entries []*Entry) error {
+	cw := r.writer(w)
+	cw.Write(csvHeader)
+	for _, e := range entries {
+		r.writeRows(cw, e)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (r *CSVRenderer) RenderEntry(w io.Writer, e *Entry, n int) error {
+	cw := r.writer(w)
+	if n == 1 {
+		cw.Write(csvHeader)
+	}
+	r.writeRows(cw, e)
+	cw.Flush()
+	return cw.Error()
+}
+
+func (r *CSVRenderer) writer(w io.Writer) *csv.Writer {
+	cw := csv.NewWriter(w)
+	cw.Comma = r.Comma
+	return cw
+}
+
+// writeRows writes rows for all responses of the entry,
+// transcription and part of speech are taken from the first definition if there is one
+func (r *CSVRenderer) writeRows(cw *csv.Writer, e *Entry) {
+	meta := joinMeta(e.Meta)
+	for _, resp := range e.Responses {
+		var ts, pos string
+		if len(resp.Definitions) > 0 {
+			ts, pos = resp.Definitions[0].Transcription, resp.Definitions[0].Pos
+		}
+		cw.Write([]string{e.Request, e.From, resp.Lang, string(resp.Status), ts, pos, strings.Join(resp.Translations, "; "), meta})
+	}
+}
+
+// joinMeta joins metadata of the entry into the single string, sorted by keys, e.g. chapter: 1; note: pet
+func joinMeta(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + ": " + meta[k]
+	}
+	return strings.Join(keys, "; ")
+}
+
+// AnkiRenderer implements Renderer and EntryRenderer interfaces to render lookup results
+// as Anki importable TSV file, with one flashcard for each response.
+// The front side of the card is the request, the back side holds translations,
+// the source and target languages and parts of speech become tags
+type AnkiRenderer struct{}
+
+// ankiHeader holds Anki file headers, which let Anki import the file without additional settings
+const ankiHeader = "#separator:tab\n#html:true\n#tags column:3\n"
+
+func (r *AnkiRenderer) Render(w io.Writer, entries []*Entry) error {
+	if _, err := io.WriteString(w, ankiHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := r.writeCards(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AnkiRenderer) RenderEntry(w io.Writer, e *Entry, n int) error {
+	if n == 1 {
+		if _, err := io.WriteString(w, ankiHeader); err != nil {
+			return err
+		}
+	}
+	return r.writeCards(w, e)
+}
+
+// writeCards writes flashcards for all responses of the entry, cards without translations are useless and skipped
+func (r *AnkiRenderer) writeCards(w io.Writer, e *Entry) error {
+	for _, resp := range e.Responses {
+		if !resp.Found() {
+			continue
+		}
+		tags := []string{ankiTag(resp.Lang)}
+		if e.From != "" {
+			tags = append(tags, ankiTag(e.From+"-"+resp.Lang))
+		}
+		var back []string
+		if len(resp.Definitions) == 0 {
+			back = append(back, template.HTMLEscapeString(strings.Join(resp.Translations, ", ")))
+		}
+		for _, def := range resp.Definitions {
+			var trs []string
+			for _, tr := range def.Translations {
+				trs = append(trs, tr.Text)
+			}
+			line := template.HTMLEscapeString(strings.Join(trs, ", "))
+			if def.Pos != "" {
+				line = "<i>" + template.HTMLEscapeString(def.Pos) + "</i> " + line
+				if tag := ankiTag(def.Pos); !containsString(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+			if def.Transcription != "" {
+				line = "[" + template.HTMLEscapeString(def.Transcription) + "] " + line
+			}
+			back = append(back, line)
+		}
+
+		fields := []string{ankiField(template.HTMLEscapeString(e.Request)), ankiField(strings.Join(back, "<br>")), strings.Join(tags, " ")}
+		if _, err := io.WriteString(w, strings.Join(fields, "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ankiField replaces characters that can't be used inside of the TSV field
+func ankiField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", "<br>").Replace(s)
+}
+
+// ankiTag makes Anki tag from the string, tags can't contain spaces
+func ankiTag(s string) string {
+	return strings.Join(strings.Fields(s), "_")
+}
+
+// containsString reports whether the list contains the string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEntries = []*Entry{
+	{Request: "dog", From: "en", Detected: true, Meta: map[string]string{"note": "pet", "chapter": "1"}, Responses: []*Response{
+		{Lang: "de", Status: StatusDictionary, Provider: "yandex", Mode: ModeDictionary, Translations: []string{"Hund", "Rüde"}, Definitions: []*Definition{{Text: "dog", Pos: "noun", Transcription: "dɒg", Translations: []*Translation{{Text: "Hund"}, {Text: "Rüde"}}}}},
+		{Lang: "it", Status: StatusTranslation, Provider: "yandex", Mode: ModeTranslation, Translations: []string{"cane"}},
+	}},
+	{Request: "black, dog", Responses: []*Response{{Lang: "de", Status: StatusTranslation, Translations: []string{"schwarzer Hund"}}}},
+	{Request: "xyz", Responses: []*Response{
+		{Lang: "de", Status: StatusNotFound},
+		{Lang: "it", Status: StatusError, Error: "(501) The specified language is not supported", Provider: "yandex", Mode: ModeTranslation},
+	}},
+}
+
+// templateWithError is the templater with the template which fails to render
+type templateWithError struct{}
+
+func (t *templateWithError) Entry() string {
+	return "{{.Undefined}}"
+}
+
+func (t *templateWithError) List() string {
+	return ""
+}
+
+func Test_NewRenderer(t *testing.T) {
+	assert.Equal(t, &TemplateRenderer{Templater: &TextTemplater{}}, NewRenderer("text"))
+	assert.Equal(t, &TemplateRenderer{Templater: &HTMLTemplater{}}, NewRenderer("html"))
+	assert.Equal(t, &JSONRenderer{}, NewRenderer("json"))
+	assert.Equal(t, &JSONLRenderer{}, NewRenderer("jsonl"))
+	assert.Equal(t, &CSVRenderer{Comma: ','}, NewRenderer("csv"))
+	assert.Equal(t, &CSVRenderer{Comma: '\t'}, NewRenderer("tsv"))
+	assert.Equal(t, &AnkiRenderer{}, NewRenderer("anki"))
+	assert.Nil(t, NewRenderer("apkg"))
+	assert.Nil(t, NewRenderer(""))
+}
+
+func Test_TemplateRenderer_Render(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, (&TemplateRenderer{Templater: &HTMLTemplater{}}).Render(&b, testEntries))
+	assert.Contains(t, b.String(), "<html>")
+	assert.Contains(t, b.String(), "Rüde")
+	// the detected language is shown
+	assert.Contains(t, b.String(), `dog <span class="lang">en</span> <span class="meta"><span>chapter: 1</span> <span>note: pet</span> </span></dt>`)
+	assert.Contains(t, b.String(), "black, dog</dt>")
+	// responses are styled by status
+	assert.Contains(t, b.String(), `<dd class="translation">`)
+	assert.Contains(t, b.String(), `<dd class="not_found">`)
+	assert.Contains(t, b.String(), "(501) The specified language is not supported")
+	// as well as their provider and mode
+	assert.Contains(t, b.String(), `it <span class="note">machine translation, yandex</span></header>`)
+	assert.Contains(t, b.String(), `de <span class="note">dictionary, yandex</span></header>`)
+
+	b.Reset()
+	require.NoError(t, (&TemplateRenderer{Templater: &TextTemplater{}}).Render(&b, testEntries))
+	assert.Contains(t, b.String(), "\ndog (en)\n")
+	assert.Contains(t, b.String(), "de (dictionary, yandex):\n")
+	assert.Contains(t, b.String(), "it (machine translation, yandex):\n1. cane\n")
+	assert.Contains(t, b.String(), "de:\nnot found\n")
+	assert.Contains(t, b.String(), "it (machine translation, yandex):\nerror: (501) The specified language is not supported\n")
+
+	assert.Error(t, (&TemplateRenderer{Templater: &templateWithError{}}).Render(&b, nil))
+}
+
+func Test_JSONRenderer_Render(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, (&JSONRenderer{}).Render(&b, testEntries))
+
+	var entries []*Entry
+	require.NoError(t, json.Unmarshal(b.Bytes(), &entries))
+	assert.Equal(t, testEntries, entries)
+	assert.Contains(t, b.String(), `"request": "dog"`)
+	assert.Contains(t, b.String(), `"from": "en"`)
+	assert.Contains(t, b.String(), `"detected": true`)
+	assert.Contains(t, b.String(), `"transcription": "dɒg"`)
+	assert.Contains(t, b.String(), `"status": "not_found"`)
+	assert.Contains(t, b.String(), `"translations": []`)
+	assert.Contains(t, b.String(), `"provider": "yandex"`)
+	assert.Contains(t, b.String(), `"mode": "translation"`)
+
+	b.Reset()
+	require.NoError(t, (&JSONRenderer{}).Render(&b, nil))
+	assert.Equal(t, "[]\n", b.String())
+}
+
+func Test_JSONLRenderer(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, (&JSONLRenderer{}).Render(&b, testEntries))
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	require.Len(t, lines, 3)
+
+	var e Entry
+	require.NoError(t, json.Unmarshal(lines[1], &e))
+	assert.Equal(t, testEntries[1], &e)
+
+	b.Reset()
+	require.NoError(t, (&JSONLRenderer{}).RenderEntry(&b, testEntries[1], 2))
+	assert.Equal(t, string(lines[1])+"\n", b.String())
+}
+
+func Test_CSVRenderer(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, (&CSVRenderer{Comma: ','}).Render(&b, testEntries))
+	assert.Equal(t, "request,from,lang,status,transcription,pos,translations,meta\n"+
+		"dog,en,de,dictionary,dɒg,noun,Hund; Rüde,chapter: 1; note: pet\n"+
+		"dog,en,it,translation,,,cane,chapter: 1; note: pet\n"+
+		"\"black, dog\",,de,translation,,,schwarzer Hund,\n"+
+		"xyz,,de,not_found,,,,\n"+
+		"xyz,,it,error,,,,\n", b.String())
+
+	b.Reset()
+	r := &CSVRenderer{Comma: '\t'}
+	require.NoError(t, r.RenderEntry(&b, testEntries[1], 1))
+	require.NoError(t, r.RenderEntry(&b, testEntries[1], 2))
+	assert.Equal(t, "request\tfrom\tlang\tstatus\ttranscription\tpos\ttranslations\tmeta\n"+
+		"black, dog\t\tde\ttranslation\t\t\tschwarzer Hund\t\n"+
+		"black, dog\t\tde\ttranslation\t\t\tschwarzer Hund\t\n", b.String())
+}
+
+func Test_AnkiRenderer(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, (&AnkiRenderer{}).Render(&b, testEntries))
+	assert.Equal(t, ankiHeader+
+		"dog\t[dɒg] <i>noun</i> Hund, Rüde\tde en-de noun\n"+
+		"dog\tcane\tit en-it\n"+
+		"black, dog\tschwarzer Hund\tde\n", b.String())
+
+	b.Reset()
+	e := &Entry{Request: "<b>\tbold", Responses: []*Response{{Lang: "en", Status: StatusDictionary, Definitions: []*Definition{
+		{Pos: "adjective", Translations: []*Translation{{Text: "fett"}}},
+		{Pos: "adjective", Translations: []*Translation{{Text: "kühn"}}},
+		{Pos: "proper noun", Translations: []*Translation{{Text: "Bold"}}},
+	}}}}
+	require.NoError(t, (&AnkiRenderer{}).RenderEntry(&b, e, 2))
+	assert.Equal(t, "&lt;b&gt; bold\t<i>adjective</i> fett<br><i>adjective</i> kühn<br><i>proper noun</i> Bold\ten adjective proper_noun\n", b.String())
+}
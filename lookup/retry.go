@@ -0,0 +1,248 @@
+package lookup
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxRetryBackoff limits the delay between retries of failed API requests
+const maxRetryBackoff = 30 * time.Second
+
+// ErrorKind classifies errors returned by provider APIs
+type ErrorKind int
+
+const (
+	// ErrRequest means that the request can't be looked up, e.g. the word is unknown,
+	// other lookups can succeed, so the next method (dictionary, then translator) is tried
+	ErrRequest ErrorKind = iota
+	// ErrTransient means that the request can succeed later, e.g. on network errors or rate limiting,
+	// such requests are retried
+	ErrTransient
+	// ErrFatal means that no request can succeed, e.g. the API key is invalid or the daily limit is exceeded
+	ErrFatal
+)
+
+// APIError is the error returned by provider API along with its kind and code
+type APIError struct {
+	Kind ErrorKind
+	// Code is the error code of the API, e.g. HTTP status, it is zero if the API has no codes
+	Code int
+	Err  error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the original error, it is used by errors.Cause
+func (e *APIError) Cause() error {
+	return e.Err
+}
+
+// findAPIError returns the API error from the chain of wrapped errors, or nil if there is no one
+func findAPIError(err error) *APIError {
+	for err != nil {
+		if e, ok := err.(*APIError); ok {
+			return e
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return nil
+}
+
+// httpErrorKind returns the kind of the error by HTTP status code of the response
+func httpErrorKind(status int) ErrorKind {
+	switch {
+	case status == 401 || status == 402 || status == 403:
+		return ErrFatal
+	case status == 408 || status == 429 || status >= 500 && status != 501:
+		return ErrTransient
+	default:
+		return ErrRequest
+	}
+}
+
+// KindOf returns the kind of the error, looking through the chain of wrapped errors.
+// Network errors are transient, unknown errors are supposed to be specific to the request
+func KindOf(err error) ErrorKind {
+	for err != nil {
+		switch e := err.(type) {
+		case *APIError:
+			return e.Kind
+		case net.Error:
+			return ErrTransient
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTransient
+		}
+
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return ErrRequest
+}
+
+// rateLimiter limits the rate of API requests, spacing them evenly
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter creates the limiter allowing rps requests per second, or nil if the rate is unlimited
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// wait blocks until the next request is allowed or the context is done, the context error is returned in the latter case
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleepContext(ctx, delay)
+}
+
+// sleepContext pauses for the duration or until the context is done, the context error is returned in the latter case
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retrier calls provider APIs, respecting the rate limit and retrying transient failures with exponential backoff
+type retrier struct {
+	retries int
+	backoff time.Duration
+	limiter *rateLimiter
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// do calls fn until it succeeds, returns not transient error or retries are exhausted.
+// Waiting for the rate limit and backoff delays are interrupted when the context is done,
+// the context error is returned in this case
+func (r *retrier) do(ctx context.Context, fn func() error) error {
+	backoff := r.backoff
+	for attempt := 0; ; attempt++ {
+		if err := r.limiter.wait(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil || KindOf(err) != ErrTransient || attempt >= r.retries {
+			return err
+		}
+
+		// random part of the delay prevents simultaneous lookups from retrying at once
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if err = r.sleep(ctx, delay); err != nil {
+			return err
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// retryingDictionary implements Dictionary interface, passing requests to the wrapped dictionary using the retrier
+type retryingDictionary struct {
+	Dictionary
+	retrier *retrier
+}
+
+func (d *retryingDictionary) Lookup(ctx context.Context, params *Params) ([]*Definition, error) {
+	var defs []*Definition
+	err := d.retrier.do(ctx, func() error {
+		var err error
+		defs, err = d.Dictionary.Lookup(ctx, params)
+		return err
+	})
+	return defs, err
+}
+
+// GetDirs returns directions supported by the wrapped dictionary, or nil if it can't list them
+func (d *retryingDictionary) GetDirs(ctx context.Context) ([]string, error) {
+	l, ok := d.Dictionary.(DirsLister)
+	if !ok {
+		return nil, nil
+	}
+
+	var dirs []string
+	err := d.retrier.do(ctx, func() error {
+		var err error
+		dirs, err = l.GetDirs(ctx)
+		return err
+	})
+	return dirs, err
+}
+
+// retryingTranslator implements Translator interface, passing requests to the wrapped translator using the retrier
+type retryingTranslator struct {
+	Translator
+	retrier *retrier
+}
+
+func (t *retryingTranslator) Translate(ctx context.Context, params *Params) (string, error) {
+	var result string
+	err := t.retrier.do(ctx, func() error {
+		var err error
+		result, err = t.Translator.Translate(ctx, params)
+		return err
+	})
+	return result, err
+}
+
+// Detect detects the language using the wrapped translator, it must implement Detector interface
+func (t *retryingTranslator) Detect(ctx context.Context, text string) (string, error) {
+	d, ok := t.Translator.(Detector)
+	if !ok {
+		return "", errors.New("translator can't detect languages")
+	}
+
+	var lang string
+	err := t.retrier.do(ctx, func() error {
+		var err error
+		lang, err = d.Detect(ctx, text)
+		return err
+	})
+	return lang, err
+}
+
+func (t *retryingTranslator) GetLangs(ctx context.Context, ui string) (*Languages, error) {
+	var langs *Languages
+	err := t.retrier.do(ctx, func() error {
+		var err error
+		langs, err = t.Translator.GetLangs(ctx, ui)
+		return err
+	})
+	return langs, err
+}
@@ -0,0 +1,142 @@
+package lookup
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingTranslator implements Translator interface, failing all calls with the error
+type failingTranslator struct {
+	err   error
+	calls int
+}
+
+func (t *failingTranslator) Translate(ctx context.Context, params *Params) (string, error) {
+	t.calls++
+	return "", t.err
+}
+
+func (t *failingTranslator) Detect(ctx context.Context, text string) (string, error) {
+	t.calls++
+	return "", t.err
+}
+
+func (t *failingTranslator) GetLangs(ctx context.Context, ui string) (*Languages, error) {
+	t.calls++
+	return nil, t.err
+}
+
+func Test_KindOf(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{errors.New("definitions are empty"), ErrRequest},
+		{errors.Wrap(&APIError{Kind: ErrFatal, Err: errors.New("(401) API key is invalid")}, "can't get translation"), ErrFatal},
+		{errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "can't get definitions"), ErrTransient},
+		{errors.Wrap(io.ErrUnexpectedEOF, "can't get translation"), ErrTransient},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.kind, KindOf(c.err), c.err.Error())
+	}
+}
+
+func Test_httpErrorKind(t *testing.T) {
+	assert.Equal(t, ErrFatal, httpErrorKind(403))
+	assert.Equal(t, ErrTransient, httpErrorKind(429))
+	assert.Equal(t, ErrTransient, httpErrorKind(503))
+	assert.Equal(t, ErrRequest, httpErrorKind(400))
+	assert.Equal(t, ErrRequest, httpErrorKind(501))
+}
+
+func Test_yandexError(t *testing.T) {
+	cases := map[string]ErrorKind{
+		"can't get translation for dog: 401, API key is invalid":                       ErrFatal,
+		"can't get definitions for dog: (403) Exceeded the daily limit":                ErrFatal,
+		"can't get translation for (500) words: 404, Exceeded the daily limit":         ErrFatal,
+		"can't get definitions for dog: (501) The specified language is not supported": ErrRequest,
+		"can't get translation for dog: 503, Service unavailable":                      ErrTransient,
+		"can't get definitions for dog: definitions are empty":                         ErrRequest,
+	}
+	for msg, kind := range cases {
+		assert.Equal(t, kind, KindOf(yandexError(errors.New(msg))), msg)
+	}
+}
+
+func Test_retrier_do(t *testing.T) {
+	var delays []time.Duration
+	r := &retrier{retries: 3, backoff: 100 * time.Millisecond, sleep: func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}}
+
+	tr := &failingTranslator{err: &APIError{Kind: ErrTransient, Err: errors.New("(429) too many requests")}}
+	_, err := (&retryingTranslator{Translator: tr, retrier: r}).Translate(context.Background(), &Params{Text: "dog"})
+	assert.EqualError(t, err, "(429) too many requests")
+	assert.Equal(t, 4, tr.calls)
+	require.Len(t, delays, 3)
+	// delays grow exponentially with the random part
+	for i, d := range delays {
+		max := r.backoff << uint(i)
+		assert.True(t, d >= max/2 && d <= max, "%v", d)
+	}
+
+	// other errors are not retried
+	tr = &failingTranslator{err: &APIError{Kind: ErrFatal, Err: errors.New("(401) API key is invalid")}}
+	_, err = (&retryingTranslator{Translator: tr, retrier: r}).Detect(context.Background(), "dog")
+	assert.Error(t, err)
+	assert.Equal(t, 1, tr.calls)
+
+	// successful calls are not repeated
+	calls := 0
+	err = r.do(context.Background(), func() error {
+		calls++
+		if calls < 2 {
+			return io.EOF
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func Test_retrier_do_cancel(t *testing.T) {
+	r := &retrier{retries: 3, backoff: time.Minute, sleep: sleepContext}
+	tr := &failingTranslator{err: &APIError{Kind: ErrTransient, Err: errors.New("(429) too many requests")}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// the backoff delay is interrupted when the context is done
+	start := time.Now()
+	_, err := (&retryingTranslator{Translator: tr, retrier: r}).Translate(ctx, &Params{Text: "dog"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, tr.calls)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func Test_rateLimiter(t *testing.T) {
+	assert.Nil(t, newRateLimiter(0))
+	// nil limiter doesn't limit
+	assert.NoError(t, newRateLimiter(0).wait(context.Background()))
+
+	l := newRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.wait(context.Background()))
+	}
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+
+	// waiting is interrupted when the context is done
+	l = newRateLimiter(0.1)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, l.wait(ctx))
+	cancel()
+	assert.Equal(t, context.Canceled, l.wait(ctx))
+}
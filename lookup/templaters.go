@@ -0,0 +1,147 @@
+package lookup
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gobuffalo/packr"
+	"github.com/pkg/errors"
+)
+
+// box used to embed templates into executable binary
+var box = packr.NewBox("templates")
+
+// templateNames holds names of all embedded templates
+var templateNames = []string{"entry.text.tmpl", "list.text.tmpl", "entry.html.tmpl", "list.html.tmpl", "layout.html.tmpl", "search.html.tmpl"}
+
+// templatesFnMap holds functions use in templates
+var templatesFnMap = template.FuncMap{
+	"inc": func(i int) int {
+		return i + 1
+	},
+	// dict used to pass multiple values (in a map) to partial template
+	"dict": func(values ...interface{}) map[string]interface{} {
+		d := make(map[string]interface{}, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			d[values[i].(string)] = values[i+1]
+		}
+		return d
+	},
+	// join joins the list using the separator, e.g. {{ .Translations | join ", " }}
+	"join": func(sep string, list []string) string {
+		return strings.Join(list, sep)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": strings.Title,
+	// truncate cuts the string to n runes, adding ellipsis if it was cut
+	"truncate": func(n int, s string) string {
+		if n < 0 || utf8.RuneCountInString(s) <= n {
+			return s
+		}
+		return string([]rune(s)[:n]) + "…"
+	},
+	// langName returns english name of the language by its code
+	"langName": LangName,
+}
+
+// loadTemplate returns the template from the user templates directory, if it is set and the template is there,
+// or the embedded one
+func loadTemplate(dir, name string) string {
+	if dir != "" {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, name)); err == nil {
+			return string(b)
+		}
+	}
+	return box.String(name)
+}
+
+// CheckTemplates parses all templates from the user templates directory to report errors before doing the job
+func CheckTemplates(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	for _, name := range templateNames {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "can't read template")
+		}
+		if err = CheckTemplate(name, string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckTemplate parses the template to report errors with the right template name and line numbers
+func CheckTemplate(name, text string) error {
+	_, err := template.New(name).Funcs(templatesFnMap).Parse(text)
+	return errors.Wrap(err, "can't parse template")
+}
+
+// ParseTemplate parses the template, built from the templater ones, to render lookup results
+func ParseTemplate(text string) (*template.Template, error) {
+	t, err := template.New("").Funcs(templatesFnMap).Parse(text)
+	return t, errors.Wrap(err, "can't parse template")
+}
+
+// Templater methods return templates (as strings) used to render lookup results.
+// The entry template defines the "entry" template used to render the single entry,
+// the list template renders the list of entries passed as the Entries field
+type Templater interface {
+	Entry() string
+	List() string
+}
+
+// LayoutTemplater is the optional interface
+// that defines the layout method used to render output file layout
+type LayoutTemplater interface {
+	Layout() string
+}
+
+// TextTemplater implements Templater interface to print lookup results to stdout and render text files.
+// Templates of the Dir directory, if it is set, override the embedded ones with the same names
+type TextTemplater struct {
+	Dir string
+}
+
+// List returns list text template from the box, which, in turn loads it from the FS
+// and embeds in the executable binary
+func (t *TextTemplater) List() string {
+	return loadTemplate(t.Dir, "list.text.tmpl")
+}
+
+func (t *TextTemplater) Entry() string {
+	return loadTemplate(t.Dir, "entry.text.tmpl")
+}
+
+// HTMLTemplater implements Templater and LayoutTemplater interfaces to render lookup results to html files.
+// Templates of the Dir directory, if it is set, override the embedded ones with the same names
+type HTMLTemplater struct {
+	Dir string
+}
+
+func (t *HTMLTemplater) Layout() string {
+	return loadTemplate(t.Dir, "layout.html.tmpl")
+}
+
+func (t *HTMLTemplater) List() string {
+	return loadTemplate(t.Dir, "list.html.tmpl")
+}
+
+func (t *HTMLTemplater) Entry() string {
+	return loadTemplate(t.Dir, "entry.html.tmpl")
+}
+
+// Search returns the template of the search form, which can be shown above results.
+// It defines the "header" block of the layout and uses Query, From, To, Error and Provider fields of the data
+func (t *HTMLTemplater) Search() string {
+	return loadTemplate(t.Dir, "search.html.tmpl")
+}
@@ -0,0 +1,100 @@
+package lookup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TextTemplater_List(t *testing.T) {
+	assert.Contains(t, (&TextTemplater{}).List(), "{{ range .Entries -}}")
+}
+
+func Test_TextTemplater_Entry(t *testing.T) {
+	assert.Contains(t, (&TextTemplater{}).Entry(), "{{ range $idx, $tr := .Translations -}}")
+}
+
+func Test_HTMLTemplater_Layout(t *testing.T) {
+	assert.Contains(t, (&HTMLTemplater{}).Layout(), "<meta charset=\"utf-8\">")
+}
+
+func Test_HTMLTemplater_List(t *testing.T) {
+	assert.Contains(t, (&HTMLTemplater{}).List(), "<ol id=\"req-list\">")
+}
+
+func Test_HTMLTemplater_Entry(t *testing.T) {
+	assert.Contains(t, (&HTMLTemplater{}).Entry(), `<dd class="{{ .Status }}">`)
+}
+
+func Test_templatesFnMap_inc(t *testing.T) {
+	incFn := templatesFnMap["inc"].(func(int) int)
+	assert.Equal(t, incFn(2), 3)
+}
+
+func Test_templatesFnMap_dict(t *testing.T) {
+	dictFn := templatesFnMap["dict"].(func(values ...interface{}) map[string]interface{})
+	args := []interface{}{"one", 1, "two", "2", "three", "drei"}
+	expected := map[string]interface{}{"one": 1, "two": "2", "three": "drei"}
+	assert.Equal(t, expected, dictFn(args...))
+
+	args = append(args, "odd")
+	assert.Panics(t, func() { dictFn(args...) })
+}
+
+func Test_templatesFnMap_strings(t *testing.T) {
+	joinFn := templatesFnMap["join"].(func(string, []string) string)
+	assert.Equal(t, "Hund, Rüde", joinFn(", ", []string{"Hund", "Rüde"}))
+
+	truncateFn := templatesFnMap["truncate"].(func(int, string) string)
+	assert.Equal(t, "Rüd…", truncateFn(3, "Rüde"))
+	assert.Equal(t, "Rüde", truncateFn(4, "Rüde"))
+	assert.Equal(t, "Rüde", truncateFn(-1, "Rüde"))
+
+	tmpl, err := ParseTemplate(`{{ .Request | upper }} {{ .Lang | langName }} {{ "xx" | langName }} {{ .Translations | join "; " | title }}`)
+	require.NoError(t, err)
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, map[string]interface{}{"Request": "dog", "Lang": "de", "Translations": []string{"hund", "rüde"}})
+	require.NoError(t, err)
+	assert.Equal(t, "DOG German xx Hund; Rüde", b.String())
+}
+
+func Test_HTMLTemplater_Search(t *testing.T) {
+	assert.Contains(t, (&HTMLTemplater{}).Search(), `{{ define "header" }}`)
+}
+
+func withTemplatesDir(t *testing.T, files map[string]string, fn func(dir string)) {
+	dir, err := ioutil.TempDir("", "lu-templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for name, text := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0600))
+	}
+	fn(dir)
+}
+
+func Test_loadTemplate(t *testing.T) {
+	withTemplatesDir(t, map[string]string{"list.text.tmpl": "custom list"}, func(dir string) {
+		assert.Equal(t, "custom list", (&TextTemplater{Dir: dir}).List())
+		assert.Contains(t, (&TextTemplater{Dir: dir}).Entry(), "{{ range $idx, $tr := .Translations -}}")
+		assert.Contains(t, (&TextTemplater{}).List(), "{{ range .Entries -}}")
+	})
+}
+
+func Test_CheckTemplates(t *testing.T) {
+	withTemplatesDir(t, map[string]string{"list.text.tmpl": "{{ range .Entries }}"}, func(dir string) {
+		err := CheckTemplates(dir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't parse template: template: list.text.tmpl:1: unexpected EOF")
+	})
+
+	withTemplatesDir(t, map[string]string{"list.text.tmpl": "{{ range .Entries }}{{ end }}"}, func(dir string) {
+		assert.NoError(t, CheckTemplates(dir))
+	})
+
+	assert.NoError(t, CheckTemplates(""))
+}
@@ -0,0 +1,177 @@
+package lookup
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yd "github.com/dafanasev/go-yandex-dictionary"
+	yt "github.com/dafanasev/go-yandex-translate"
+	"github.com/pkg/errors"
+)
+
+// yandexDictionaryAPI defines interface which is used instead of Dictionary struct from yandex-dictionary package
+// other implementation is a mock, used for tests
+type yandexDictionaryAPI interface {
+	Lookup(params *yd.Params) (*yd.Entry, error)
+	GetLangs() ([]string, error)
+}
+
+// yandexTranslatorAPI defines interface which is used instead of Translator struct from yandex-translate package
+// other implementation is a mock, used for tests
+type yandexTranslatorAPI interface {
+	Translate(lang, text string) (*yt.Response, error)
+	GetLangs(ui string) (*yt.Languages, error)
+}
+
+// NewYandex creates the provider using Yandex.Dictionary and Yandex.Translate with the given API keys,
+// ui is the language of the dictionary interface, e.g. names of parts of speech
+func NewYandex(dictionaryKey, translateKey, ui string) *Provider {
+	return &Provider{
+		Name:       "yandex",
+		Dictionary: &yandexDictionary{api: yd.NewUsingLang(dictionaryKey, ui)},
+		Translator: &yandexTranslator{api: yt.New(translateKey)},
+	}
+}
+
+// yandexDictionary implements Dictionary interface using Yandex.Dictionary.
+// The interface language is set when API client is created, so UI of lookup params is the same.
+// Yandex API packages have no contexts, so the context is checked only before requests
+type yandexDictionary struct {
+	api yandexDictionaryAPI
+}
+
+func (d *yandexDictionary) Lookup(ctx context.Context, params *Params) ([]*Definition, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entry, err := d.api.Lookup(&yd.Params{
+		Lang:      params.From + "-" + params.To,
+		Text:      params.Text,
+		Family:    params.Family,
+		Morpho:    params.Morpho,
+		PosFilter: params.PosFilter,
+	})
+	if err != nil {
+		return nil, yandexError(err)
+	}
+	return newDefinitions(entry), nil
+}
+
+// GetDirs returns translation directions supported by Yandex.Dictionary, e.g. en-de
+func (d *yandexDictionary) GetDirs(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dirs, err := d.api.GetLangs()
+	if err != nil {
+		return nil, yandexError(err)
+	}
+	return dirs, nil
+}
+
+// yandexTranslator implements Translator interface using Yandex.Translate,
+// like the dictionary, it checks the context only before requests
+type yandexTranslator struct {
+	api yandexTranslatorAPI
+}
+
+func (t *yandexTranslator) Translate(ctx context.Context, params *Params) (string, error) {
+	// if the source language is not specified Yandex.Translate detects it
+	lang := params.To
+	if params.From != "" {
+		lang = params.From + "-" + params.To
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	resp, err := t.api.Translate(lang, params.Text)
+	if err != nil {
+		return "", yandexError(err)
+	}
+	return resp.Result(), nil
+}
+
+// Detect detects the language of the text, Yandex.Translate does it when only the target language is specified
+func (t *yandexTranslator) Detect(ctx context.Context, text string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	resp, err := t.api.Translate("en", text)
+	if err != nil {
+		return "", yandexError(err)
+	}
+	if lang := resp.Detected["lang"]; lang != "" {
+		return lang, nil
+	}
+	// the response language is the translation direction, e.g. de-en
+	if parts := strings.SplitN(resp.Lang, "-", 2); len(parts) == 2 && parts[0] != "" {
+		return parts[0], nil
+	}
+	return "", errors.Errorf("can't detect language of %s", text)
+}
+
+func (t *yandexTranslator) GetLangs(ctx context.Context, ui string) (*Languages, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resp, err := t.api.GetLangs(ui)
+	if err != nil {
+		return nil, yandexError(err)
+	}
+	return &Languages{Names: resp.Langs, Dirs: resp.Dirs}, nil
+}
+
+// yandexCodeRe matches error codes in errors of yandex API packages,
+// e.g. "(401) API key is invalid" or "can't get translation for dog: 401, API key is invalid"
+var yandexCodeRe = regexp.MustCompile(`\((\d{3})\)|: (\d{3}), `)
+
+// yandexError classifies the error of yandex API by its code:
+// invalid or blocked API key and exceeded daily limit are fatal (403 for dictionary and 404 for translate),
+// too many requests and server errors are transient, others are specific to the request, e.g. unsupported direction
+func yandexError(err error) error {
+	matches := yandexCodeRe.FindAllStringSubmatch(err.Error(), -1)
+	if len(matches) == 0 {
+		return err
+	}
+	// the code follows the request text, which can contain anything
+	m := matches[len(matches)-1]
+	code, _ := strconv.Atoi(m[1] + m[2])
+
+	kind := ErrRequest
+	switch code {
+	case 401, 402, 403, 404:
+		kind = ErrFatal
+	case 429, 500, 502, 503, 504:
+		kind = ErrTransient
+	}
+	return &APIError{Kind: kind, Code: code, Err: err}
+}
+
+// newDefinitions converts yandex dictionary data structures into definitions
+func newDefinitions(dictResp *yd.Entry) []*Definition {
+	var defs []*Definition
+	for _, d := range dictResp.Def {
+		def := &Definition{Text: d.Text, Pos: d.Pos, Transcription: d.Ts}
+		for _, t := range d.Tr {
+			tr := &Translation{Text: t.Text, Pos: t.Pos, Synonyms: texts(t.Syn), Meanings: texts(t.Mean)}
+			for _, ex := range t.Ex {
+				tr.Examples = append(tr.Examples, &Example{Text: ex.Text, Translations: texts(ex.Tr)})
+			}
+			def.Translations = append(def.Translations, tr)
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// texts unwraps strings from the list of yandex dictionary text structs
+func texts(ts []yd.Text) []string {
+	var strs []string
+	for _, t := range ts {
+		strs = append(strs, t.Text)
+	}
+	return strs
+}
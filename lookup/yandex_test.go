@@ -0,0 +1,41 @@
+package lookup
+
+import (
+	"context"
+	"testing"
+
+	yd "github.com/dafanasev/go-yandex-dictionary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDictionaryAPI records params of the last call to the wrapped dictionary API
+type recordingDictionaryAPI struct {
+	yandexDictionaryAPI
+	params *yd.Params
+}
+
+func (r *recordingDictionaryAPI) Lookup(params *yd.Params) (*yd.Entry, error) {
+	r.params = params
+	return r.yandexDictionaryAPI.Lookup(params)
+}
+
+func Test_yandexDictionary_Lookup(t *testing.T) {
+	api := &recordingDictionaryAPI{yandexDictionaryAPI: &dictionaryMock{}}
+	d := &yandexDictionary{api: api}
+
+	defs, err := d.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "dog", Family: true, PosFilter: true})
+	require.NoError(t, err)
+	assert.Len(t, defs, 2)
+	assert.Equal(t, &yd.Params{Lang: "en-de", Text: "dog", Family: true, PosFilter: true}, api.params)
+
+	_, err = d.Lookup(context.Background(), &Params{From: "en", To: "de", Text: "dogs", Morpho: true})
+	assert.Error(t, err)
+	assert.True(t, api.params.Morpho)
+}
+
+func Test_NewYandex(t *testing.T) {
+	p := NewYandex("dict", "translate", "ru")
+	assert.Equal(t, "yandex", p.Name)
+	assert.Equal(t, yd.NewUsingLang("dict", "ru"), p.Dictionary.(*yandexDictionary).api)
+}
@@ -1,29 +1,69 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/dafanasev/lu/internal/mock"
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func Test_Lu_lookup(t *testing.T) {
-	lu := &Lu{opts: options{FromLang: "en"}}
-	lu.dictionary = &dictionaryMock{}
-	lu.translator = &translatorMock{}
+// newTestClient returns the client using the dictionary and the translator, e.g. the ones of the mock provider
+func newTestClient(t *testing.T, d lookup.Dictionary, tr lookup.Translator, opts lookup.Options) *lookup.Client {
+	c, err := lookup.New(&lookup.Provider{Name: "mock", Dictionary: d, Translator: tr}, opts)
+	require.NoError(t, err)
+	return c
+}
+
+// newMockClient returns the client using the mock provider
+func newMockClient(t *testing.T, opts lookup.Options) *lookup.Client {
+	p := mock.New()
+	return newTestClient(t, p.Dictionary, p.Translator, opts)
+}
+
+// failingTranslator implements lookup.Translator interface, failing all calls with the error
+type failingTranslator struct {
+	err error
+}
+
+func (t *failingTranslator) Translate(ctx context.Context, params *lookup.Params) (string, error) {
+	return "", t.err
+}
+
+func (t *failingTranslator) GetLangs(ctx context.Context, ui string) (*lookup.Languages, error) {
+	return nil, t.err
+}
+
+func Test_Lu_lookupCycle_error(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}}}
+	tr := &failingTranslator{err: &lookup.APIError{Kind: lookup.ErrFatal, Err: errors.New("(401) API key is invalid")}}
+	lu.client = newTestClient(t, mock.New().Dictionary, tr, lookup.Options{})
+	lu.input = newTextReader(strings.NewReader("dog\ncat\ndog\n"), false)
 
-	assert.Equal(t, []string{"Hund", "Rüde", "geiler Bock"}, lu.lookup("dog", "de"))
-	assert.Equal(t, []string{"schwarzer Hund"}, lu.lookup("black dog", "de"))
-	assert.Equal(t, []string{"no translation"}, lu.lookup("cat", "de"))
-	assert.Equal(t, []string{"no translation"}, lu.lookup("black dog", "fr"))
+	ch := make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	var entries []*lookup.Entry
+	for e := range ch {
+		entries = append(entries, e)
+	}
+	// the cycle stops at the failed lookup
+	require.Len(t, entries, 1)
+	assert.Equal(t, "dog", entries[0].Request)
+	assert.EqualError(t, lu.err, "(401) API key is invalid")
+	assert.False(t, lu.completed)
 }
 
 func Test_Lu_lookupCycle(t *testing.T) {
 	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}}}
-	lu.dictionary = &dictionaryMock{}
-	lu.translator = &translatorMock{}
+	lu.client = newMockClient(t, lookup.Options{})
 
 	s := `
 	dog
@@ -31,25 +71,29 @@ func Test_Lu_lookupCycle(t *testing.T) {
 	
 	cat
 	`
-	lu.scanner = bufio.NewScanner(strings.NewReader(s))
+	lu.input = newTextReader(strings.NewReader(s), false)
 
 	done := make(chan struct{})
-	ch := make(chan *entry)
+	ch := make(chan *lookup.Entry)
 	close(done)
 	go lu.lookupCycle(done, ch)
+	// the stopped cycle ends without reading the data source
+	for range ch {
+	}
 	assert.Equal(t, 0, len(lu.history))
+	assert.False(t, lu.completed)
 
 	expected := map[string][]string{
 		"dog":       {"Hund", "Rüde", "geiler Bock"},
 		"black dog": {"schwarzer Hund"},
-		"cat":       {"no translation"},
+		"cat":       nil,
 	}
 
 	done = make(chan struct{})
-	ch = make(chan *entry)
+	ch = make(chan *lookup.Entry)
 	go lu.lookupCycle(done, ch)
 
-	var entries []*entry
+	var entries []*lookup.Entry
 	for entry := range ch {
 		entries = append(entries, entry)
 		translations, ok := expected[entry.Request]
@@ -61,14 +105,197 @@ func Test_Lu_lookupCycle(t *testing.T) {
 	assert.Equal(t, 3, len(lu.history))
 }
 
+func Test_Lu_lookupCycle_segmenter(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}}, skipLines: 1}
+	lu.client = newMockClient(t, lookup.Options{})
+	lu.segmenter = &wordSegmenter{stopwords: map[string]bool{"the": true}}
+	lu.occurrences = newOccurrences("en")
+	lu.input = newTextReader(strings.NewReader("the cat\nThe black dog\ncat\n"), false)
+
+	ch := make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	var entries []*lookup.Entry
+	for e := range ch {
+		entries = append(entries, e)
+	}
+	// words of skipped lines are counted, but not looked up again
+	require.Len(t, entries, 2)
+	assert.Equal(t, "black", entries[0].Request)
+	assert.Equal(t, "dog", entries[1].Request)
+	assert.Equal(t, 2, entries[1].Line)
+	assert.Equal(t, "The black dog", entries[1].Context)
+	assert.Equal(t, []string{"Hund", "Rüde", "geiler Bock"}, entries[1].Responses[0].Translations)
+	assert.True(t, lu.completed)
+}
+
+func Test_Lu_lookupCycle_duplicates(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}}, occurrences: newOccurrences("en")}
+	lu.client = newMockClient(t, lookup.Options{})
+	lu.input = newTextReader(strings.NewReader("dog\ncat\n Dog\ndog\n"), false)
+
+	ch := make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	for range ch {
+	}
+	require.Len(t, lu.history, 2)
+	lu.countOccurrences()
+	assert.Equal(t, "dog", lu.history[0].Request)
+	assert.Equal(t, 3, lu.history[0].Count)
+	assert.Equal(t, 1, lu.history[0].Line)
+	assert.Equal(t, 4, lu.history[0].LastLine)
+	assert.Equal(t, 1, lu.history[1].Count)
+
+	// repeated requests are looked up every time without the counter
+	lu = &Lu{opts: lu.opts, client: lu.client}
+	lu.input = newTextReader(strings.NewReader("dog\ncat\n Dog\ndog\n"), false)
+	ch = make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	for range ch {
+	}
+	assert.Len(t, lu.history, 4)
+}
+
+func Test_Lu_lookupCycle_input(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "auto", ToLangs: []string{"de", "en"}}}
+	lu.client = newMockClient(t, lookup.Options{})
+	var err error
+	lu.input, err = newInputReader(strings.NewReader("word,note\ndog,pet\n[en] dog\n"), inputCSV, "", false, false)
+	require.NoError(t, err)
+
+	ch := make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	var entries []*lookup.Entry
+	for e := range ch {
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, map[string]string{"note": "pet"}, entries[0].Meta)
+	assert.True(t, entries[0].Detected)
+	// the language set in the source file isn't detected
+	assert.Equal(t, "en", entries[1].From)
+	assert.False(t, entries[1].Detected)
+	assert.Equal(t, 3, entries[1].Line)
+
+	// the read error stops the cycle
+	lu = &Lu{opts: lu.opts, client: lu.client}
+	lu.input, err = newInputReader(strings.NewReader(`["dog", 1]`), inputJSON, "", false, false)
+	require.NoError(t, err)
+	ch = make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	entries = nil
+	for e := range ch {
+		entries = append(entries, e)
+	}
+	assert.Len(t, entries, 1)
+	assert.EqualError(t, lu.err, "can't read source file, record 2 must be string or object")
+	assert.False(t, lu.completed)
+
+	// the unknown language of the record doesn't stop the cycle, and colons of the text are not languages
+	lu = &Lu{opts: lu.opts, client: lu.client, langNames: map[string]string{"en": "english", "de": "german"}}
+	lu.input = newTextReader(strings.NewReader("[en] dog\nsee: also\n[xx] Hund\nno: way\n[en] cat\n"), true)
+	ch = make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	var reqs []string
+	for e := range ch {
+		reqs = append(reqs, e.From+" "+e.Request)
+	}
+	assert.Equal(t, []string{"en dog", " see: also", " [xx] Hund", " no: way", "en cat"}, reqs)
+	assert.NoError(t, lu.err)
+	assert.True(t, lu.completed)
+}
+
+func Test_Lu_lookupCycle_detect(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "auto", ToLangs: []string{"de", "en"}, Jobs: 2}}
+	lu.client = newMockClient(t, lookup.Options{Jobs: lu.opts.Jobs})
+	lu.input = newTextReader(strings.NewReader("dog\nHund\nxyz\n"), false)
+
+	ch := make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	var entries []*lookup.Entry
+	for e := range ch {
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 3)
+
+	// the target language equal to the detected source one is skipped
+	assert.Equal(t, "en", entries[0].From)
+	assert.True(t, entries[0].Detected)
+	require.Len(t, entries[0].Responses, 1)
+	assert.Equal(t, "de", entries[0].Responses[0].Lang)
+	assert.Equal(t, []string{"Hund", "Rüde", "geiler Bock"}, entries[0].Responses[0].Translations)
+
+	assert.Equal(t, "de", entries[1].From)
+	require.Len(t, entries[1].Responses, 1)
+	assert.Equal(t, "en", entries[1].Responses[0].Lang)
+	assert.Equal(t, []string{"dog"}, entries[1].Responses[0].Translations)
+
+	// if the language can't be detected, the request is looked up for all languages
+	assert.Equal(t, "", entries[2].From)
+	assert.False(t, entries[2].Detected)
+	assert.Len(t, entries[2].Responses, 2)
+}
+
 func Test_Lu_supportedLangs(t *testing.T) {
-	lu := &Lu{}
-	lu.translator = &translatorMock{}
+	lu := &Lu{client: newMockClient(t, lookup.Options{})}
 
-	_, err := lu.supportedLangs("")
+	_, err := lu.supportedLangs(context.Background(), "")
 	require.Error(t, err)
 
-	resp, err := lu.supportedLangs("en")
+	resp, err := lu.supportedLangs(context.Background(), "en")
 	require.NoError(t, err)
 	assert.Equal(t, []string{"de: german", "en: english", "it: italian"}, resp)
 }
+
+// slowDictionary returns results of the dictionary with random delays
+type slowDictionary struct {
+	lookup.Dictionary
+}
+
+func (d *slowDictionary) Lookup(ctx context.Context, params *lookup.Params) ([]*lookup.Definition, error) {
+	time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
+	return d.Dictionary.Lookup(ctx, params)
+}
+
+func Test_Lu_lookupCycle_concurrent(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de", "fr", "it"}, Jobs: 8}}
+	p := mock.New()
+	lu.client = newTestClient(t, &slowDictionary{p.Dictionary}, p.Translator, lookup.Options{Jobs: lu.opts.Jobs})
+
+	var reqs []string
+	for i := 0; i < 50; i++ {
+		reqs = append(reqs, fmt.Sprintf("word %d", i), "dog")
+	}
+	lu.input = newTextReader(strings.NewReader(strings.Join(reqs, "\n")), false)
+
+	done := make(chan struct{})
+	ch := make(chan *lookup.Entry)
+	go lu.lookupCycle(done, ch)
+
+	i := 0
+	for entry := range ch {
+		require.Equal(t, reqs[i], entry.Request)
+		require.Len(t, entry.Responses, 3)
+		for j, lang := range lu.opts.ToLangs {
+			assert.Equal(t, lang, entry.Responses[j].Lang)
+		}
+		if entry.Request == "dog" {
+			assert.Equal(t, "Hund", entry.Responses[0].Translations[0])
+		}
+		i++
+	}
+	assert.Equal(t, len(reqs), i)
+	assert.Equal(t, len(reqs), len(lu.history))
+
+	// stopping in the middle of the cycle
+	lu.history = nil
+	lu.input = newTextReader(strings.NewReader(strings.Join(reqs, "\n")), false)
+	done = make(chan struct{})
+	ch = make(chan *lookup.Entry)
+	go lu.lookupCycle(done, ch)
+
+	<-ch
+	close(done)
+	for range ch {
+	}
+	assert.True(t, len(lu.history) < len(reqs))
+}
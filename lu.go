@@ -1,72 +1,65 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"fmt"
 	"html/template"
 	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
 
-	yd "github.com/dafanasev/go-yandex-dictionary"
-	yt "github.com/dafanasev/go-yandex-translate"
+	"github.com/dafanasev/lu/lookup"
 	"github.com/pkg/errors"
 )
 
 // Lu is the main workhorse of the app.
 // It holds all the objects needed to perform the job.
 type Lu struct {
-	dictionary dictionary
-	translator translator
+	// client looks requests up using dictionary and translator of the selected provider
+	client *lookup.Client
 	// parsed command line flags
 	opts options
-	// line by line data source scanner
-	scanner *bufio.Scanner
+	// input reads records of the data source
+	input inputReader
+	// segmenter splits lines of the data source into requests
+	segmenter segmenter
+	// occurrences counts repeated requests, it is nil if they are looked up every time
+	occurrences *occurrences
 	// templater used to write to stdout
 	stdoutTemplater stdoutTemplater
+	// template parsed from stdoutTemplater on the first use
+	stdoutTemplate *template.Template
+	// renderer used to write to stdout instead of stdoutTemplater, if other format is specified
+	stdoutRenderer lookup.Renderer
 	// templater used to write to output file
-	fileTemplater templater
-	srcFile       *os.File
-	dstFile       *os.File
+	fileTemplater lookup.Templater
+	// renderer used to write to output file instead of fileTemplater, for machine readable formats
+	fileRenderer lookup.Renderer
+	srcFile      *os.File
+	// stdin is set if requests are read from stdin
+	stdin bool
+	// destination file, results are written to it while the lookup runs and at the end
+	dst *outputFile
+	// state of the lookup of the source file, used to resume it if it is interrupted
+	state *resumeState
+	// skipLines is the number of source lines processed by the interrupted lookup
+	skipLines int
+	// doneLines holds the last complete source line for each entry passed by the lookup cycle,
+	// it is guarded by doneMu, because the state is saved by the reader of the cycle
+	doneLines map[*lookup.Entry]int
+	doneMu    sync.Mutex
+	// eof is set when the data source is read to the end
+	eof bool
+	// completed is set when the lookup cycle has passed all entries of the data source
+	completed bool
+	// err is the error which stopped the lookup cycle
+	err error
+	// langNames holds names of languages supported by the provider, if it can list them
+	langNames map[string]string
 	// history of all requests and responses
-	history []*entry
+	history []*lookup.Entry
 }
 
-// dictionary defines interface which is used instead of Dictionary struct from yandex-dictionary package
-// other implementation is a mock, used for tests and debug
-type dictionary interface {
-	Lookup(params *yd.Params) (*yd.Entry, error)
-}
-
-// translator defines interface which is used instead of Translator struct from yandex-translate package
-// other implementation is a mock, used for tests and debug
-type translator interface {
-	Translate(lang, text string) (*yt.Response, error)
-	GetLangs(ui string) (*yt.Languages, error)
-}
-
-// entry holds request and corresponding responses, one for each specified language
-type entry struct {
-	Request   string
-	Responses []*response
-}
-
-// response holds the single response
-type response struct {
-	Lang         string
-	Translations []string
-}
-
-// entriesByReq is the synonym for the entries pointers list, needed for sorting
-type entriesByReq []*entry
-
-func (br entriesByReq) Len() int           { return len(br) }
-func (br entriesByReq) Swap(i, j int)      { br[i], br[j] = br[j], br[i] }
-func (br entriesByReq) Less(i, j int) bool { return br[i].Request < br[j].Request }
-
 // newLu creates the new instance of Lu struct
 func newLu(args []string, opts options) (*Lu, error) {
 	lu := &Lu{opts: opts}
@@ -80,40 +73,108 @@ func newLu(args []string, opts options) (*Lu, error) {
 	if err != nil {
 		return nil, err
 	}
-	lu.scanner = bufio.NewScanner(r)
+	lu.stdin = r == os.Stdin
+	format := inputFormat(lu.opts.InputFormat, lu.opts.SrcFileName)
+	lu.input, err = newInputReader(r, format, lu.opts.Column, lu.opts.NoHeader, lu.srcFile != nil)
+	if err != nil {
+		return nil, err
+	}
+	lu.segmenter, err = newSegmenter(&lu.opts)
+	if err != nil {
+		return nil, err
+	}
+	if !lu.opts.KeepDuplicates {
+		lu.occurrences = newOccurrences(lu.opts.FromLang)
+	}
 
 	err = lu.setupOutput()
 	if err != nil {
 		return nil, err
 	}
 
+	err = lu.setupResume()
+	if err != nil {
+		return nil, err
+	}
+
 	return lu, nil
 }
 
-// setupAPI sets dictionary and translator, mock ones for tests
-// (real tests for dicionary and translator are in corresponding packages)
+// setupAPI creates the client of the selected provider, the mock one for tests
+// (real tests for yandex dicionary and translator are in corresponding packages)
 func (lu *Lu) setupAPI() error {
-	if os.Getenv("LU_TEST") == "1" {
-		lu.dictionary = &dictionaryMock{}
-		lu.translator = &translatorMock{}
-		return nil
+	test := os.Getenv("LU_TEST") == "1"
+	name := lu.opts.Provider
+	switch {
+	case test:
+		name = "mock"
+	case name == "":
+		name = defaultProvider
 	}
-	dictionaryAPIKey := os.Getenv("LU_YANDEX_DICTIONARY_API_KEY")
-	if dictionaryAPIKey == "" {
-		return errors.New("the required environment variable LU_YANDEX_DICTIONARY_API_KEY is not set")
+	p, err := newProvider(name, &lu.opts)
+	if err != nil {
+		return err
+	}
+	if err = lu.checkMode(p); err != nil {
+		return err
 	}
 
-	translateAPIKey := os.Getenv("LU_YANDEX_TRANSLATE_API_KEY")
-	if translateAPIKey == "" {
-		return errors.New("the required environment variable LU_YANDEX_TRANSLATE_API_KEY is not set")
+	opts := lookup.Options{
+		UI:        lu.opts.DictUI,
+		Family:    lu.opts.Family,
+		Morpho:    lu.opts.Morpho,
+		PosFilter: lu.opts.PosFilter,
+		DictOnly:  lu.opts.DictOnly,
+		MTOnly:    lu.opts.MTOnly,
+		Jobs:      lu.opts.Jobs,
+	}
+	if !test {
+		if _, ok := p.Translator.(lookup.Detector); !ok && lu.opts.FromLang == lookup.AutoLang && !lu.opts.ShowLangs {
+			return errors.Errorf("provider %s can't detect languages, the language to translate from must be specified", name)
+		}
+		opts.Retries, opts.RetryBackoff, opts.RateLimit = lu.opts.Retries, lu.opts.RetryBackoff, lu.opts.RateLimit
+		if opts.Cache, err = lu.openCache(); err != nil {
+			return err
+		}
 	}
 
-	lu.dictionary = yd.New(dictionaryAPIKey)
-	lu.translator = yt.New(translateAPIKey)
+	lu.client, err = lookup.New(p, opts)
+	return err
+}
 
+// checkMode checks that the provider has the service needed for the dictionary only or translation only lookups
+func (lu *Lu) checkMode(p *lookup.Provider) error {
+	if lu.opts.DictOnly && p.Dictionary == nil {
+		return errors.Errorf("provider %s has no dictionary, it can't be used with --dict-only", p.Name)
+	}
+	if lu.opts.MTOnly && p.Translator == nil {
+		return errors.Errorf("provider %s has no translator, it can't be used with --mt-only", p.Name)
+	}
 	return nil
 }
 
+// openCache returns the cache of responses, or nil if the cache is turned off or its directory is not specified
+func (lu *Lu) openCache() (*lookup.Cache, error) {
+	if lu.opts.NoCache || lu.opts.CacheDir == "" {
+		return nil, nil
+	}
+
+	c, err := lookup.NewCache(lu.opts.CacheDir, lu.opts.CacheTTL, lu.opts.CacheMaxSize<<20)
+	if err != nil {
+		return nil, err
+	}
+	c.Refresh = lu.opts.Refresh
+	return c, nil
+}
+
+// defaultCacheDir returns the directory used for the cache if it isn't specified explicitly
+func defaultCacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "lu")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".cache", "lu")
+}
+
 // setupInput sets the data source, it can be stdin, string built from command line arguments or source file
 func (lu *Lu) setupInput(args []string) (io.Reader, error) {
 	if len(args) > 0 {
@@ -131,59 +192,159 @@ func (lu *Lu) setupInput(args []string) (io.Reader, error) {
 	return os.Stdin, nil
 }
 
-// setupOutput sets the destination file and templater, if destination file name is specified
+// setupOutput sets the destination file and templater or renderer, if destination file name is specified.
+// Format is taken from the format option or from the destination file extension
 func (lu *Lu) setupOutput() error {
-	lu.stdoutTemplater = &textTemplater{}
+	dir := lu.opts.TemplatesDir
+	if err := lookup.CheckTemplates(dir); err != nil {
+		return err
+	}
+
+	lu.stdoutTemplater = newTextTemplater(dir)
+	switch {
+	case lu.opts.StdoutTemplate != "":
+		t, err := newCustomTemplater(lu.opts.StdoutTemplate, newTextTemplater(dir))
+		if err != nil {
+			return err
+		}
+		lu.stdoutTemplater = t
+	case lu.opts.Format == "html":
+		lu.stdoutRenderer = &lookup.TemplateRenderer{Templater: newHTMLTemplater(dir)}
+	case lu.opts.Format != "text":
+		lu.stdoutRenderer = lookup.NewRenderer(lu.opts.Format)
+	}
 
 	if lu.opts.DstFileName != "" {
 		var err error
-		lu.dstFile, err = os.OpenFile(lu.opts.DstFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		lu.fileTemplater, lu.fileRenderer, err = newFileOutput(lu.opts.DstFileName, lu.opts.Format, lu.opts.Template, dir)
 		if err != nil {
 			return err
 		}
 
-		lu.fileTemplater = func(ext string) templater {
-			if ext == "html" {
-				return &htmlTemplater{}
-			}
-			return &textTemplater{}
-		}(filepath.Ext(lu.opts.DstFileName)[1:])
+		r := lu.fileRenderer
+		if r == nil {
+			r = &lookup.TemplateRenderer{Templater: lu.fileTemplater}
+		}
+		sorter, err := lu.sorter()
+		if err != nil {
+			return err
+		}
+		lu.dst, err = newOutputFile(lu.opts.DstFileName, r, newDecoder(lu.fileTemplater, lu.fileRenderer), sorter)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// newFileOutput returns templater or renderer, used to write results to the file.
+// The format is taken from the format argument, if it is not empty, or from the file extension.
+// If the template file is specified, custom templater is returned regardless of the format.
+// Templates of the templates directory override the embedded ones
+func newFileOutput(fname, format, templateFile, templatesDir string) (lookup.Templater, lookup.Renderer, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(fname), ".")
+	}
+	if format == "apkg" {
+		return nil, nil, errors.New("Anki packages are not supported, use the anki format to write Anki importable TSV file")
+	}
+
+	var t lookup.Templater = newTextTemplater(templatesDir)
+	if format == "html" {
+		t = newHTMLTemplater(templatesDir)
+	}
+	if templateFile != "" {
+		ct, err := newCustomTemplater(templateFile, t)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ct, nil, nil
+	}
+
+	if format != "text" && format != "html" {
+		if r := lookup.NewRenderer(format); r != nil {
+			return nil, r, nil
+		}
+	}
+	return t, nil, nil
+}
+
+// shouldPrintResults reports whether lookup results should be printed to stdout.
+// It is so if there is no destination file, i.e. destination is stdout,
+// or if there is no source file, because in this case source is stdin
+// and we want to see output in the terminal too
+func (lu *Lu) shouldPrintResults() bool {
+	return lu.srcFile == nil || lu.dst == nil
+}
+
 // close cleans up the resources allocated by instance of lu
 func (lu *Lu) close() {
 	if lu.srcFile != nil {
 		lu.srcFile.Close()
 		lu.srcFile = nil
 	}
+}
 
-	if lu.dstFile != nil {
-		lu.dstFile.Close()
-		lu.dstFile = nil
+// writeFile writes history, possibly sorted, to the specified output file.
+// The lookup state is removed if all lines of the source file are processed
+func (lu *Lu) writeFile() error {
+	lu.countOccurrences()
+	err := lu.dst.write(lu.history)
+	if err != nil {
+		return err
+	}
+	if lu.state != nil && lu.completed {
+		return lu.removeState()
 	}
+	return nil
 }
 
-// writeFile writes history, possibly sorted, to the specified output file
-func (lu *Lu) writeFile() error {
-	if lu.opts.Sort {
-		sort.Sort(entriesByReq(lu.history))
+// sorter returns the sorter of results, or nil if they are output in the input order
+func (lu *Lu) sorter() (*entriesSorter, error) {
+	keys, err := parseSortKeys(lu.opts.Sort)
+	if err != nil || keys == nil {
+		return nil, err
 	}
+	return newEntriesSorter(keys, lu.opts.FromLang, lu.opts.ToLangs), nil
+}
 
-	text := lu.fileTemplater.entry() + lu.fileTemplater.list()
-	// if templater supports layout, use it
-	if lf, ok := lu.fileTemplater.(layoutTemplater); ok {
-		text += lf.layout()
+// countOccurrences sets occurrence counts of looked up requests, when the data source is read.
+// On resume, counts of requests looked up before are updated too
+func (lu *Lu) countOccurrences() {
+	if lu.occurrences == nil {
+		return
 	}
-	t := template.Must(template.New("").Funcs(templatesFnMap).Parse(text))
+	lu.occurrences.apply(lu.history)
+	if lu.state != nil && lu.dst != nil {
+		lu.occurrences.apply(lu.dst.merged)
+	}
+}
 
-	var b bytes.Buffer
-	err := t.Execute(&b, struct{ Entries []*entry }{lu.history})
+// checkpoint adds the entry to the output file, which is written from time to time while the lookup runs
+func (lu *Lu) checkpoint(e *lookup.Entry) error {
+	if lu.dst == nil {
+		return nil
+	}
+	return lu.dst.add(e)
+}
+
+// writeStdout writes history, possibly sorted, to stdout,
+// if the stdout format can't be written entry by entry, e.g. json or html
+func (lu *Lu) writeStdout() error {
+	if lu.stdoutRenderer == nil {
+		return nil
+	}
+	if _, ok := lu.stdoutRenderer.(lookup.EntryRenderer); ok {
+		return nil
+	}
+
+	lu.countOccurrences()
+	sorter, err := lu.sorter()
 	if err != nil {
 		return err
 	}
-
-	fmt.Fprint(lu.dstFile, b.String())
-	return nil
+	if sorter != nil {
+		sorter.sort(lu.history)
+	}
+	return lu.stdoutRenderer.Render(os.Stdout, lu.history)
 }
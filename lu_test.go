@@ -1,58 +1,50 @@
 package main
 
 import (
-	"bytes"
-	"io"
+	"io/ioutil"
 	"os"
-	"sort"
 	"strings"
 	"testing"
 
+	"github.com/dafanasev/lu/lookup"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 type templateWithError struct{}
 
-func (t *templateWithError) entry() string {
+func (t *templateWithError) Entry() string {
 	return "{{.Undefined}}"
 }
 
-func (t *templateWithError) list() string {
+func (t *templateWithError) List() string {
 	return ""
 }
 
-func Test_Lu_entriesByReq(t *testing.T) {
-	entries := []*entry{{Request: "bcd"}, {Request: "abc"}}
-	sort.Sort(entriesByReq(entries))
-	assert.Equal(t, []*entry{{Request: "abc"}, {Request: "bcd"}}, entries)
-}
-
 func Test_Lu_writeFile(t *testing.T) {
 	withSetup := func(setupFn func(lu *Lu), assertsFn func(result string, err error)) {
 		lu := &Lu{}
-		lu.history = []*entry{
-			{Request: "dog", Responses: []*response{{Lang: "de", Translations: []string{"Hund", "Rüde"}}}},
-			{Request: "cat", Responses: []*response{{Lang: "de", Translations: []string{"Katze"}}}},
-			{Request: "pig", Responses: []*response{{Lang: "de", Translations: []string{"Schwein"}}}},
-			{Request: "horse", Responses: []*response{{Lang: "de", Translations: []string{"Pferd", "Ross"}}}},
+		lu.history = []*lookup.Entry{
+			{Request: "dog", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Hund", "Rüde"}}}},
+			{Request: "cat", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Katze"}}}},
+			{Request: "pig", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Schwein"}}}},
+			{Request: "horse", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Pferd", "Ross"}}}},
 		}
 		lu.fileTemplater = &textTemplater{}
-		r, w, _ := os.Pipe()
-		defer r.Close()
-		defer w.Close()
-		lu.dstFile = w
+		f, _ := ioutil.TempFile("", "lu")
+		f.Close()
+		defer os.Remove(f.Name())
 
 		if setupFn != nil {
 			setupFn(lu)
 		}
+		sorter, err := lu.sorter()
+		require.NoError(t, err)
+		lu.dst = &outputFile{name: f.Name(), enc: &lookup.TemplateRenderer{Templater: lu.fileTemplater}, sorter: sorter}
 
-		err := lu.writeFile()
-		w.Close()
-
-		var b bytes.Buffer
-		io.Copy(&b, r)
-		assertsFn(b.String(), err)
+		err = lu.writeFile()
+		b, _ := ioutil.ReadFile(f.Name())
+		assertsFn(string(b), err)
 	}
 
 	withSetup(nil, func(result string, err error) {
@@ -64,7 +56,7 @@ func Test_Lu_writeFile(t *testing.T) {
 	})
 
 	withSetup(func(lu *Lu) {
-		lu.fileTemplater = &htmlTemplater{}
+		lu.fileTemplater = &lookup.HTMLTemplater{}
 	}, func(result string, err error) {
 		require.NoError(t, err)
 		assert.Contains(t, result, "<html>")
@@ -73,7 +65,19 @@ func Test_Lu_writeFile(t *testing.T) {
 	})
 
 	withSetup(func(lu *Lu) {
-		lu.opts.Sort = true
+		lu.history[0].Responses[0].Definitions = []*lookup.Definition{{
+			Text: "dog", Pos: "noun", Transcription: "dɒg",
+			Translations: []*lookup.Translation{{Text: "Hund", Synonyms: []string{"Köter"}, Examples: []*lookup.Example{{Text: "barking dog", Translations: []string{"bellender Hund"}}}}},
+		}}
+	}, func(result string, err error) {
+		require.NoError(t, err)
+		assert.Contains(t, result, "dog [dɒg] noun")
+		assert.Contains(t, result, "syn: Köter")
+		assert.Contains(t, result, "ex: barking dog - bellender Hund")
+	})
+
+	withSetup(func(lu *Lu) {
+		lu.opts.Sort = sortRequest
 	}, func(result string, err error) {
 		assert.Contains(t, result, "********")
 		require.NoError(t, err)
@@ -90,36 +94,34 @@ func Test_Lu_writeFile(t *testing.T) {
 }
 
 func Test_Lu_close(t *testing.T) {
-	r, w, _ := os.Pipe()
-	lu := &Lu{srcFile: r, dstFile: w}
+	r, _, _ := os.Pipe()
+	lu := &Lu{srcFile: r}
 	lu.close()
 	assert.Nil(t, lu.srcFile)
-	assert.Nil(t, lu.dstFile)
 }
 
 func Test_Lu_setupAPI(t *testing.T) {
 	lu := &Lu{}
-	oldD := os.Getenv("LU_YANDEX_DICTIONARY_API_KEY")
-	oldT := os.Getenv("LU_YANDEX_TRANSLATE_API_KEY")
-	defer os.Setenv("LU_YANDEX_TRANSLATE_API_KEY", oldT)
-	defer os.Setenv("LU_YANDEX_DICTIONARY_API_KEY", oldD)
-
-	os.Unsetenv("LU_YANDEX_DICTIONARY_API_KEY")
 	err := lu.setupAPI()
-	assert.EqualError(t, err, "the required environment variable LU_YANDEX_DICTIONARY_API_KEY is not set")
-
-	os.Setenv("LU_YANDEX_DICTIONARY_API_KEY", "stub")
+	assert.EqualError(t, err, "Yandex.Dictionary API key is not set, use the LU_YANDEX_DICTIONARY_API_KEY environment variable or the yandex-dictionary-key config option")
 
-	os.Unsetenv("LU_YANDEX_TRANSLATE_API_KEY")
+	lu.opts.YandexDictKey = "stub"
 	err = lu.setupAPI()
-	assert.EqualError(t, err, "the required environment variable LU_YANDEX_TRANSLATE_API_KEY is not set")
-
-	os.Setenv("LU_YANDEX_TRANSLATE_API_KEY", "stub")
+	assert.EqualError(t, err, "Yandex.Translate API key is not set, use the LU_YANDEX_TRANSLATE_API_KEY environment variable or the yandex-translate-key config option")
 
+	lu.opts.YandexTranslateKey = "stub"
 	err = lu.setupAPI()
 	require.NoError(t, err)
-	assert.NotNil(t, lu.dictionary)
-	assert.NotNil(t, lu.translator)
+	assert.Equal(t, "yandex", lu.client.Provider())
+
+	lu = &Lu{opts: options{Provider: "dictd", DictServer: "localhost:2628", FromLang: "auto"}}
+	err = lu.setupAPI()
+	assert.EqualError(t, err, "provider dictd can't detect languages, the language to translate from must be specified")
+	lu.opts.FromLang = "en"
+	assert.NoError(t, lu.setupAPI())
+	assert.Equal(t, "dictd", lu.client.Provider())
+	lu.opts.MTOnly = true
+	assert.EqualError(t, lu.setupAPI(), "provider dictd has no translator, it can't be used with --mt-only")
 }
 
 func Test_Lu_setupInput(t *testing.T) {
@@ -164,6 +166,84 @@ func Test_Lu_setupOutput(t *testing.T) {
 	lu = &Lu{opts: options{DstFileName: fname}}
 	err = lu.setupOutput()
 	require.NoError(t, err)
-	assert.Equal(t, &htmlTemplater{}, lu.fileTemplater)
+	assert.Equal(t, &lookup.HTMLTemplater{}, lu.fileTemplater)
+	assert.Nil(t, lu.fileRenderer)
+	os.Remove(fname)
+
+	fname = "out.csv"
+	lu = &Lu{opts: options{DstFileName: fname}}
+	err = lu.setupOutput()
+	require.NoError(t, err)
+	assert.Equal(t, &lookup.CSVRenderer{Comma: ','}, lu.fileRenderer)
+	assert.Nil(t, lu.stdoutRenderer)
+	lu.close()
 	os.Remove(fname)
+
+	// format option overrides the extension and is used for stdout too
+	fname = "out"
+	lu = &Lu{opts: options{DstFileName: fname, Format: "json"}}
+	err = lu.setupOutput()
+	require.NoError(t, err)
+	assert.Equal(t, &lookup.JSONRenderer{}, lu.fileRenderer)
+	assert.Equal(t, &lookup.JSONRenderer{}, lu.stdoutRenderer)
+	lu.close()
+	os.Remove(fname)
+
+	lu = &Lu{opts: options{DstFileName: "out.txt", Format: "anki"}}
+	err = lu.setupOutput()
+	require.NoError(t, err)
+	assert.Equal(t, &lookup.AnkiRenderer{}, lu.fileRenderer)
+	lu.close()
+	os.Remove("out.txt")
+
+	lu = &Lu{opts: options{DstFileName: "deck.apkg"}}
+	err = lu.setupOutput()
+	assert.Error(t, err)
+
+	lu = &Lu{opts: options{DstFileName: "out.txt", Template: "not_existed.tmpl"}}
+	err = lu.setupOutput()
+	assert.Error(t, err)
+	assert.Nil(t, lu.dst)
+
+	ioutil.WriteFile("custom.tmpl", []byte("{{ range .Entries }}{{ .Request }}{{ end }}"), 0600)
+	defer os.Remove("custom.tmpl")
+	lu = &Lu{opts: options{DstFileName: "out.json", Template: "custom.tmpl", StdoutTemplate: "custom.tmpl"}}
+	err = lu.setupOutput()
+	require.NoError(t, err)
+	assert.Nil(t, lu.fileRenderer)
+	assert.Equal(t, &customTemplater{text: "{{ range .Entries }}{{ .Request }}{{ end }}", base: &textTemplater{}}, lu.fileTemplater)
+	assert.Equal(t, &customTemplater{text: "{{ range .Entries }}{{ .Request }}{{ end }}", base: &textTemplater{}}, lu.stdoutTemplater)
+	lu.close()
+	os.Remove("out.json")
+
+	lu = &Lu{opts: options{Format: "html"}}
+	err = lu.setupOutput()
+	require.NoError(t, err)
+	assert.Equal(t, &lookup.TemplateRenderer{Templater: &lookup.HTMLTemplater{}}, lu.stdoutRenderer)
+}
+
+func Test_Lu_writeStdout(t *testing.T) {
+	lu := &Lu{history: []*lookup.Entry{{Request: "dog"}, {Request: "cat"}}, opts: options{Sort: sortRequest}}
+	require.NoError(t, lu.writeStdout())
+
+	// entry renderers write to stdout entry by entry, not at the end
+	lu.stdoutRenderer = &lookup.JSONLRenderer{}
+	result := captureStdout(func() { require.NoError(t, lu.writeStdout()) })
+	assert.Equal(t, "", result)
+
+	lu.stdoutRenderer = &lookup.JSONRenderer{}
+	result = captureStdout(func() { require.NoError(t, lu.writeStdout()) })
+	assert.Contains(t, result, `"request": "cat"`)
+	assert.Equal(t, "cat", lu.history[0].Request)
+}
+
+func Test_Lu_shouldPrintResults(t *testing.T) {
+	lu := &Lu{}
+	assert.True(t, lu.shouldPrintResults())
+	lu.srcFile = os.Stdin
+	assert.True(t, lu.shouldPrintResults())
+	lu.dst = &outputFile{}
+	assert.False(t, lu.shouldPrintResults())
+	lu.srcFile = nil
+	assert.True(t, lu.shouldPrintResults())
 }
@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"html/template"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
-	"sync"
 	"syscall"
+	"time"
 
+	"github.com/dafanasev/lu/lookup"
 	"github.com/jessevdk/go-flags"
 	"github.com/pkg/errors"
 )
@@ -19,13 +21,83 @@ const version = "0.1.1"
 // options used by go-flags package to parse command line arguments into.
 // For FromLang and ToLangs it can also get values from environment variables
 type options struct {
-	FromLang    string   `short:"f" long:"from" env:"LU_DEFAULT_FROM_LANG" description:"language to translate from"`
-	ToLangs     []string `short:"t" long:"to" env:"LU_DEFAULT_TO_LANGS" description:"languages to translate to"`
-	SrcFileName string   `short:"i" long:"source" description:"source file name"`
-	DstFileName string   `short:"o" long:"output" description:"destination file name"`
-	Sort        bool     `short:"s" long:"sort" description:"sort alphabetically"`
-	ShowLangs   bool     `short:"l" long:"languages" description:"show supported languages"`
-	Version     bool     `short:"v" long:"version" description:"show version"`
+	FromLang       string   `short:"f" long:"from" env:"LU_DEFAULT_FROM_LANG" default:"auto" description:"language to translate from, auto to detect the language of each request"`
+	ToLangs        []string `short:"t" long:"to" env:"LU_DEFAULT_TO_LANGS" description:"languages to translate to"`
+	SrcFileName    string   `short:"i" long:"source" description:"source file name"`
+	DstFileName    string   `short:"o" long:"output" description:"destination file name"`
+	Sort           string   `short:"s" long:"sort" optional:"yes" optional-value:"request" description:"sort results by comma separated keys: request, translation, from, count or line, prefixed with - for the descending order, e.g. --sort=-count,request, -s sorts by requests"`
+	InputFormat    string   `long:"input-format" choice:"text" choice:"csv" choice:"tsv" choice:"json" choice:"jsonl" description:"source format, by default it is taken from the source file extension, text for other ones"`
+	Column         string   `long:"column" description:"name or number of the CSV column, or the key of JSON objects, holding requests, the first column or the request key by default"`
+	NoHeader       bool     `long:"no-header" description:"the first row of the CSV source file holds requests, not column names"`
+	KeepDuplicates bool     `long:"keep-duplicates" description:"look up repeated requests every time they occur, instead of counting them"`
+	Split          string   `long:"split" env:"LU_SPLIT" choice:"line" choice:"word" choice:"sentence" choice:"delimiter" default:"line" description:"how to split the input into requests: by lines, words, sentences or the delimiter"`
+	Delimiter      string   `long:"delimiter" default:";" description:"delimiter of requests when the input is split by the delimiter"`
+	StopwordsFile  string   `long:"stopwords" description:"file with words which are not looked up when the input is split by words, built-in lists are used for some languages"`
+	KeepStopwords  bool     `long:"keep-stopwords" description:"look up the most common words when the input is split by words"`
+	ReportMissing  string   `long:"report-missing" description:"file to list requests which got no translation in, one per line"`
+	Resume         bool     `long:"resume" no-ini:"true" description:"continue the interrupted lookup of the source file, skipping lines already written to the destination file"`
+	ShowLangs      bool     `short:"l" long:"languages" no-ini:"true" description:"show supported languages"`
+	LangsUI        string   `long:"languages-ui" env:"LU_LANGUAGES_UI" default:"en" description:"language of language names shown by -l"`
+	JSON           bool     `long:"json" no-ini:"true" description:"show supported languages as JSON, used with -l"`
+	Version        bool     `short:"v" long:"version" no-ini:"true" description:"show version"`
+	ConfigFile     string   `long:"config" env:"LU_CONFIG" no-ini:"true" description:"config file, ~/.config/lu/config.ini by default"`
+	Profile        string   `long:"profile" env:"LU_PROFILE" no-ini:"true" description:"config file profile to use, e.g. german for the [profile.german] section"`
+	Format         string   `short:"F" long:"format" env:"LU_FORMAT" choice:"text" choice:"html" choice:"json" choice:"jsonl" choice:"csv" choice:"tsv" choice:"anki" description:"output format, by default it is taken from the destination file extension"`
+	Template       string   `long:"template" description:"template file used to render the destination file"`
+	StdoutTemplate string   `long:"stdout-template" description:"template file used to render results printed to stdout"`
+	TemplatesDir   string   `long:"templates-dir" env:"LU_TEMPLATES_DIR" description:"directory with templates overriding the embedded ones"`
+	NoInteractive  bool     `long:"no-interactive" description:"don't use the interactive mode when stdin is the terminal"`
+	ReplHistory    string   `long:"repl-history" env:"LU_REPL_HISTORY" description:"file to keep the interactive mode input history in"`
+	Jobs           int      `short:"j" long:"jobs" env:"LU_JOBS" default:"4" description:"number of simultaneous lookups"`
+
+	Provider           string   `short:"p" long:"provider" env:"LU_PROVIDER" default:"yandex" description:"translation provider: yandex, libretranslate or dictd"`
+	DictOnly           bool     `long:"dict-only" description:"use only the dictionary, without falling back to the machine translation"`
+	MTOnly             bool     `long:"mt-only" description:"use only the machine translation, without looking the dictionary up"`
+	DictUI             string   `long:"dictionary-ui" env:"LU_DICTIONARY_UI" description:"language of dictionary articles interface, e.g. of parts of speech names"`
+	Family             bool     `long:"family" description:"exclude obscene words from dictionary articles"`
+	Morpho             bool     `long:"morpho" description:"look up the dictionary form of the word, e.g. dog for dogs"`
+	PosFilter          bool     `long:"pos-filter" description:"keep only translations having the same part of speech as the request"`
+	YandexDictKey      string   `long:"yandex-dictionary-key" env:"LU_YANDEX_DICTIONARY_API_KEY" description:"Yandex.Dictionary API key"`
+	YandexTranslateKey string   `long:"yandex-translate-key" env:"LU_YANDEX_TRANSLATE_API_KEY" description:"Yandex.Translate API key"`
+	LibreTranslateURL  string   `long:"libretranslate-url" env:"LU_LIBRETRANSLATE_URL" default:"http://localhost:5000" description:"LibreTranslate compatible server URL"`
+	LibreTranslateKey  string   `long:"libretranslate-key" env:"LU_LIBRETRANSLATE_API_KEY" description:"LibreTranslate API key"`
+	DictServer         string   `long:"dict-server" env:"LU_DICT_SERVER" default:"localhost:2628" description:"DICT protocol server address"`
+	DictDatabases      []string `long:"dict-database" env:"LU_DICT_DATABASES" env-delim:"," description:"DICT database for the translation direction, e.g. en-de=fd-eng-deu"`
+
+	Retries      int           `long:"retries" env:"LU_RETRIES" default:"3" description:"number of retries of API requests failed due to network errors or rate limiting"`
+	RetryBackoff time.Duration `long:"retry-backoff" env:"LU_RETRY_BACKOFF" default:"500ms" description:"delay before the first retry, it doubles with each next one"`
+	RateLimit    float64       `long:"rate-limit" env:"LU_RATE_LIMIT" default:"0" description:"maximum number of API requests per second, 0 means unlimited"`
+
+	CacheDir     string        `long:"cache-dir" env:"LU_CACHE_DIR" description:"directory to store cached responses in"`
+	CacheTTL     time.Duration `long:"cache-ttl" env:"LU_CACHE_TTL" default:"720h" description:"time to live of cached responses"`
+	CacheMaxSize int64         `long:"cache-max-size" env:"LU_CACHE_MAX_SIZE" default:"50" description:"maximum cache size in megabytes, 0 means unlimited"`
+	NoCache      bool          `long:"no-cache" description:"don't use cached responses and don't cache new ones"`
+	Refresh      bool          `long:"refresh" description:"ignore cached responses and replace them with the new ones"`
+
+	VocabularyFile string `long:"vocabulary" env:"LU_VOCABULARY" description:"file to keep the vocabulary of looked up requests in"`
+	NoVocabulary   bool   `long:"no-vocabulary" description:"don't add looked up requests to the vocabulary"`
+
+	Cache   cacheCommand   `command:"cache" description:"show cache statistics or purge cached responses"`
+	Config  configCommand  `command:"config" description:"show the effective configuration"`
+	Serve   serveCommand   `command:"serve" description:"run HTTP server providing lookups, JSON API and the search page"`
+	History historyCommand `command:"history" description:"list, search, delete or export the vocabulary of looked up requests"`
+
+	// command holds the name of the subcommand to run, e.g. "cache stats", it is empty for lookups
+	command string
+	// config holds information about the config file used
+	config *config
+	// settings holds effective values of options and their sources
+	settings []*setting
+}
+
+// attributionWriter returns the writer for the attribution required by the provider, it is stdout,
+// unless results are printed there in the machine-readable format or by the template, which output must stay valid
+func attributionWriter(opts options) io.Writer {
+	if opts.Format != "" && opts.Format != "text" || opts.StdoutTemplate != "" || opts.Template != "" ||
+		opts.ShowLangs && opts.JSON {
+		return os.Stderr
+	}
+	return os.Stdout
 }
 
 func main() {
@@ -34,7 +106,12 @@ func main() {
 		exitWithError(err)
 	}
 
-	defer func() { fmt.Println("Powered by Yandex.dictionary and Yandex.translate (https://translate.yandex.ru)") }()
+	if opts.Provider == "yandex" {
+		w := attributionWriter(opts)
+		defer func() {
+			fmt.Fprintln(w, "Powered by Yandex.dictionary and Yandex.translate (https://translate.yandex.ru)")
+		}()
+	}
 
 	// if -v or -l flags specified, do corresponding action and exit
 	if opts.Version {
@@ -42,51 +119,123 @@ func main() {
 		return
 	}
 
+	if opts.command != "" {
+		err = runCommand(opts)
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
 	lu, err := newLu(args, opts)
 	if err != nil {
 		exitWithError(err)
 	}
 
 	if opts.ShowLangs {
-		err = showLangs(lu)
+		filter := langsFilter{dictionary: opts.DictOnly, translation: opts.MTOnly}
+		// languages are filtered only by flags, not by defaults from environment variables or the config file
+		if opts.setByFlag("from") && opts.FromLang != lookup.AutoLang {
+			filter.from = opts.FromLang
+		}
+		if opts.setByFlag("to") {
+			if len(opts.ToLangs) > 1 {
+				exitWithError(errors.New("only one language to translate to can be used to filter languages"))
+			}
+			filter.to = opts.ToLangs[0]
+		}
+		err = showLangs(context.Background(), os.Stdout, lu, opts.LangsUI, filter, opts.JSON)
 		if err != nil {
 			exitWithError(err)
 		}
 		return
 	}
 
+	// check languages before the lookup, so typos don't waste API calls
+	err = lu.checkLangs(context.Background(), os.Stderr)
+	if err != nil {
+		exitWithError(err)
+	}
+
 	done := make(chan struct{})
 	go handleExitSignal(done)
 
-	// otherwise start lookup cycle
-	entriesCh := make(chan *entry)
-	go lu.lookupCycle(done, entriesCh)
+	if lu.interactive() {
+		// run the interactive session if the user is at the terminal
+		err = lu.repl(done)
+		if err != nil {
+			exitWithError(err)
+		}
+	} else {
+		// otherwise start lookup cycle
+		entriesCh := make(chan *lookup.Entry)
+		go lu.lookupCycle(done, entriesCh)
+
+		// and print out results (or progress, if input AND output file is specified)
+		// (see lu.shouldPrintResults method)
+		n := 0
+		for entry := range entriesCh {
+			n++
+			printResults(lu, entry, n)
+			err = lu.checkpoint(entry)
+			if err != nil {
+				exitWithError(err)
+			}
+		}
+	}
 
-	// and print out results (or progress, if input AND output file is specified)
-	// (see lu.shouldPrintResults method)
-	n := 0
-	for entry := range entriesCh {
-		n++
-		printResults(lu, entry, n)
+	// when entries channel is closed write history to stdout if its format requires the whole document
+	if lu.shouldPrintResults() {
+		err = lu.writeStdout()
+		if err != nil {
+			exitWithError(err)
+		}
 	}
 
-	// when entries channel is closed and destination file is specified write history to it
-	if lu.dstFile != nil {
+	// and if destination file is specified write history to it too
+	if lu.dst != nil {
 		err = lu.writeFile()
 		if err != nil {
 			exitWithError(err)
 		}
 	}
 
+	// and list requests which got no translation if needed
+	if opts.ReportMissing != "" {
+		err = writeMissing(opts.ReportMissing, lu.history)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	// and remember looked up requests, results are already written, so the failure is not fatal
+	err = lu.recordVocabulary()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+	}
+
 	// and free resources (close files atm)
 	lu.close()
+
+	// results looked up before the failure are written, so the lookup can be resumed
+	if lu.err != nil {
+		exitWithError(lu.err)
+	}
 }
 
 // parseCommandLine parses command line arguments into lookup argument and application flags
 func parseCommandLine() ([]string, options, error) {
 	var opts options
 	// need new parser because default one has the PrintErrors flag set but we don't need it
-	args, err := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash).Parse()
+	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
+	// lookup requests are passed as arguments too, so commands must be optional
+	parser.SubcommandsOptional = true
+	// values from the config file become defaults, so flags and environment variables override them
+	cfg, err := loadConfig(parser, os.Args[1:])
+	if err != nil {
+		return nil, options{}, err
+	}
+	args, err := parser.Parse()
 	if err != nil {
 		// check if error is actually not an error but the help flag
 		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
@@ -95,13 +244,31 @@ func parseCommandLine() ([]string, options, error) {
 		return nil, options{}, errors.Wrap(err, "can not parse arguments")
 	}
 
+	for cmd := parser.Active; cmd != nil; cmd = cmd.Active {
+		opts.command = strings.TrimSpace(opts.command + " " + cmd.Name)
+	}
+	opts.config = cfg
+
 	if opts.SrcFileName != "" && opts.SrcFileName == opts.DstFileName {
 		return nil, options{}, errors.New("source and destination must be different files")
 	}
+	if _, err = parseSortKeys(opts.Sort); err != nil {
+		return nil, options{}, err
+	}
+	if opts.DictOnly && opts.MTOnly {
+		return nil, options{}, errors.New("--dict-only and --mt-only flags can't be used together")
+	}
+	if opts.Resume && (opts.SrcFileName == "" || opts.DstFileName == "") {
+		return nil, options{}, errors.New("both source (-i flag) and destination (-o flag) files must be specified to resume the lookup")
+	}
 
-	// to and from languages should be specified if we do real work
-	if (opts.FromLang == "" || len(opts.ToLangs) == 0) && !opts.Version && !opts.ShowLangs {
-		return nil, options{}, errors.New("translation direction (-f and -t flags must be specified")
+	// languages to translate to should be specified if we do real work,
+	// the language to translate from is detected if it isn't specified
+	if len(opts.ToLangs) == 0 && !opts.Version && !opts.ShowLangs && opts.command == "" {
+		return nil, options{}, errors.New("languages to translate to (-t flag) must be specified")
+	}
+	if opts.FromLang == "" {
+		opts.FromLang = lookup.AutoLang
 	}
 
 	// in the environment variable list of destination languages can be specified as a colon separated string
@@ -109,25 +276,55 @@ func parseCommandLine() ([]string, options, error) {
 		opts.ToLangs = strings.Split(opts.ToLangs[0], ":")
 	}
 
+	if opts.CacheDir == "" {
+		opts.CacheDir = defaultCacheDir()
+	}
+	if opts.TemplatesDir == "" {
+		opts.TemplatesDir = defaultTemplatesDir()
+	}
+	if opts.ReplHistory == "" {
+		opts.ReplHistory = defaultReplHistory()
+	}
+	if opts.VocabularyFile == "" {
+		opts.VocabularyFile = defaultVocabularyFile()
+	}
+	// settings are taken when all defaults are set, options refer to fields of opts
+	opts.settings = effectiveSettings(parser, cfg)
+
 	return args, opts, nil
 }
 
-// printResults prints lookup results or progress, depending on srcFile and dstFile values.
+// printResults prints lookup results or progress, depending on srcFile and dst values.
 // It prints to stdout if there is no destination file - i.e. destination is stdout
 // if there is no destination file - i.e. destination is stdout
 // or if there is no source file, because in this case source is stdin
 // and we want to see output in the terminal too, even if the destination file is specified
 // otherwise show progress
-func printResults(lu *Lu, entry *entry, n int) {
-	if lu.srcFile == nil || lu.dstFile == nil {
-		var once sync.Once
-		var t *template.Template
-		once.Do(func() {
-			t = template.Must(template.New("").Funcs(templatesFnMap).Parse(lu.stdoutTemplater.stdout()))
-		})
-		err := t.Execute(os.Stdout, entry)
+func printResults(lu *Lu, entry *lookup.Entry, n int) {
+	if lu.shouldPrintResults() {
+		if lu.stdoutRenderer != nil {
+			// renderers that can't render entries one by one write the whole history at the end,
+			// entries rendered one by one have no counts of repeated requests, which are known at the end only
+			if enc, ok := lu.stdoutRenderer.(lookup.EntryRenderer); ok {
+				err := enc.RenderEntry(os.Stdout, entry, n)
+				if err != nil {
+					exitWithError(errors.Wrap(err, "can't render results"))
+				}
+			}
+			return
+		}
+
+		// the template is parsed once, on the first call
+		if lu.stdoutTemplate == nil {
+			t, err := lookup.ParseTemplate(lu.stdoutTemplater.stdout())
+			if err != nil {
+				exitWithError(err)
+			}
+			lu.stdoutTemplate = t
+		}
+		err := lu.stdoutTemplate.Execute(os.Stdout, entry)
 		if err != nil {
-			exitWithError(errors.Wrap(err, "can't parse template"))
+			exitWithError(errors.Wrap(err, "can't render template"))
 		}
 	} else {
 		fmt.Printf("%d. Got results for %s\n", n, entry.Request)
@@ -149,16 +346,3 @@ func handleExitSignal(done chan struct{}) {
 
 	close(done)
 }
-
-// showLangs prints supported languages list to the terminal
-func showLangs(lu *Lu) error {
-	fmt.Println("Supported languages:")
-	langs, err := lu.supportedLangs("en")
-	if err != nil {
-		return err
-	}
-	for _, lang := range langs {
-		fmt.Println(lang)
-	}
-	return nil
-}
@@ -2,30 +2,44 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/dafanasev/lu/lookup"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 // TestMain unsets LU_* environment variables before running test suite
-// to get clean test environment and restores them after running
+// to get clean test environment and restores them after running.
+// Home and data directories are set to the temporary one,
+// so the vocabulary and the input history of tests running lu don't get into the user files
 func TestMain(m *testing.M) {
-	keys := []string{"LU_YANDEX_DICTIONARY_API_KEY", "LU_YANDEX_TRANSLATE_API_KEY", "LU_DEFAULT_FROM_LANG", "LU_DEFAULT_TO_LANGS"}
+	keys := []string{"LU_YANDEX_DICTIONARY_API_KEY", "LU_YANDEX_TRANSLATE_API_KEY", "LU_DEFAULT_FROM_LANG", "LU_DEFAULT_TO_LANGS", "LU_CACHE_DIR", "LU_PROVIDER", "LU_CONFIG", "LU_PROFILE", "LU_VOCABULARY", "LU_REPL_HISTORY",
+		"XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME", "HOME"}
 	envVars := make(map[string]string, len(keys))
 	for _, k := range keys {
 		envVars[k] = os.Getenv(k)
 		os.Unsetenv(k)
 	}
+	// don't let the user config file affect tests
+	os.Setenv("XDG_CONFIG_HOME", "/nonexistent")
+	home, err := ioutil.TempDir("", "lu-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
 
 	code := m.Run()
 
+	os.RemoveAll(home)
 	for _, k := range keys {
 		os.Setenv(k, envVars[k])
 	}
@@ -37,17 +51,31 @@ func Test_parseCommandLine(t *testing.T) {
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
 
-	for _, flag := range []string{"", "-fen", "-tde"} {
+	for _, flag := range []string{"", "-fen"} {
 		os.Args = append([]string{"lu"}, flag)
 		_, _, err := parseCommandLine()
-		assert.EqualError(t, err, "translation direction (-f and -t flags must be specified")
+		assert.EqualError(t, err, "languages to translate to (-t flag) must be specified")
 	}
+	// the language to translate from is detected by default
+	os.Args = []string{"lu", "-tde"}
+	_, opts, err := parseCommandLine()
+	require.NoError(t, err)
+	assert.Equal(t, "auto", opts.FromLang)
+
 	for _, flag := range []string{"-v", "-l"} {
 		os.Args = append([]string{"lu"}, flag)
 		_, _, err := parseCommandLine()
 		assert.NoError(t, err)
 	}
 
+	os.Args = []string{"lu", "-tde", "--dict-only", "--mt-only"}
+	_, _, err = parseCommandLine()
+	assert.EqualError(t, err, "--dict-only and --mt-only flags can't be used together")
+
+	os.Args = []string{"lu", "-tde", "--sort=-count,size"}
+	_, _, err = parseCommandLine()
+	assert.EqualError(t, err, "unknown sort key size, use request, translation, from, count or line")
+
 	os.Args = []string{"lu"}
 
 	oldF := os.Getenv("LU_DEFAULT_FROM_LANG")
@@ -58,11 +86,11 @@ func Test_parseCommandLine(t *testing.T) {
 	os.Setenv("LU_DEFAULT_TO_LANGS", "sp:fr")
 	defer os.Setenv("LU_DEFAULT_TO_LANGS", oldT)
 
-	_, opts, _ := parseCommandLine()
+	_, opts, _ = parseCommandLine()
 
 	assert.Equal(t, "en", opts.FromLang)
 	assert.Equal(t, []string{"sp", "fr"}, opts.ToLangs)
-	assert.False(t, opts.Sort)
+	assert.Equal(t, "", opts.Sort)
 	assert.False(t, opts.ShowLangs)
 	assert.False(t, opts.Version)
 
@@ -72,7 +100,7 @@ func Test_parseCommandLine(t *testing.T) {
 	assert.Equal(t, []string{"ru", "it", "de"}, opts.ToLangs)
 	assert.Equal(t, "in.txt", opts.SrcFileName)
 	assert.Equal(t, "out.html", opts.DstFileName)
-	assert.True(t, opts.Sort)
+	assert.Equal(t, "request", opts.Sort)
 	assert.True(t, opts.ShowLangs)
 	assert.True(t, opts.Version)
 	assert.NoError(t, err)
@@ -88,6 +116,21 @@ func Test_parseCommandLine(t *testing.T) {
 	require.Error(t, err)
 	assert.EqualError(t, err, "source and destination must be different files")
 
+	os.Args = []string{"lu", "cache", "purge", "--all", "--cache-dir", "/tmp/lu"}
+	_, opts, err = parseCommandLine()
+	require.NoError(t, err)
+	assert.Equal(t, "cache purge", opts.command)
+	assert.True(t, opts.Cache.Purge.All)
+	assert.Equal(t, "/tmp/lu", opts.CacheDir)
+
+	os.Args = []string{"lu", "history", "search", "--since", "7d", "dog"}
+	_, opts, err = parseCommandLine()
+	require.NoError(t, err)
+	assert.Equal(t, "history search", opts.command)
+	assert.Equal(t, "dog", opts.History.Search.Args.Query)
+	assert.Equal(t, "7d", opts.History.Search.Since)
+	assert.NotEmpty(t, opts.VocabularyFile)
+
 	os.Args = []string{"lu", "-e"}
 	_, opts, err = parseCommandLine()
 	require.Equal(t, "", opts.SrcFileName)
@@ -102,13 +145,17 @@ func (m *stdoutTemplaterMock) stdout() string {
 }
 
 func Test_printResults(t *testing.T) {
-	e := &entry{Request: "dog", Responses: []*response{{Lang: "de", Translations: []string{"Hund", "Rüde"}}}}
+	e := &lookup.Entry{Request: "dog", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Hund", "Rüde"}}}}
 
 	// write to buffer instead of stdout so we can test output
-	printResultsWrapper := func(e *entry, data struct{ src, dst *os.File }) string {
+	type files struct {
+		src *os.File
+		dst *outputFile
+	}
+	printResultsWrapper := func(e *lookup.Entry, data files) string {
 		lu := &Lu{}
 		lu.srcFile = data.src
-		lu.dstFile = data.dst
+		lu.dst = data.dst
 		lu.stdoutTemplater = &textTemplater{}
 		old := os.Stdout
 		r, w, _ := os.Pipe()
@@ -127,21 +174,30 @@ func Test_printResults(t *testing.T) {
 		return <-resultChan
 	}
 
-	cases := []struct{ src, dst *os.File }{
+	cases := []files{
 		{nil, nil},
 		{os.Stdin, nil},
-		{nil, os.Stdout},
+		{nil, &outputFile{}},
 	}
 	for _, cs := range cases {
-		result := printResultsWrapper(e, struct{ src, dst *os.File }{src: cs.src, dst: cs.dst})
+		result := printResultsWrapper(e, cs)
 		assert.NotContains(t, result, "1. Got results")
 		assert.Contains(t, result, "Rüde")
 	}
 
-	result := printResultsWrapper(e, struct{ src, dst *os.File }{src: os.Stdin, dst: os.Stdout})
+	result := printResultsWrapper(e, files{src: os.Stdin, dst: &outputFile{}})
 	assert.Contains(t, result, "1. Got results")
 	assert.NotContains(t, result, "Rüde")
 
+	lu := &Lu{stdoutRenderer: &lookup.CSVRenderer{Comma: ','}}
+	result = captureStdout(func() { printResults(lu, e, 1) })
+	assert.Equal(t, "request,from,lang,status,transcription,pos,translations,meta\ndog,,de,,,,Hund; Rüde,\n", result)
+
+	// renderers which can't render entry by entry write nothing until the end
+	lu = &Lu{stdoutRenderer: &lookup.JSONRenderer{}}
+	result = captureStdout(func() { printResults(lu, e, 1) })
+	assert.Equal(t, "", result)
+
 	// testing error in the template, app should exit with code = 1
 	// in order to test it, run app in the separate process
 
@@ -158,6 +214,35 @@ func Test_printResults(t *testing.T) {
 	assert.True(t, ok && !exitError.Success())
 }
 
+// captureStdout returns everything written to stdout by fn
+func captureStdout(fn func()) string {
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	resultCh := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		r.Close()
+		resultCh <- b.String()
+	}()
+
+	fn()
+	os.Stdout = old
+	w.Close()
+	return <-resultCh
+}
+
+func Test_attributionWriter(t *testing.T) {
+	assert.Equal(t, os.Stdout, attributionWriter(options{}))
+	assert.Equal(t, os.Stdout, attributionWriter(options{Format: "text"}))
+	assert.Equal(t, os.Stdout, attributionWriter(options{ShowLangs: true}))
+	assert.Equal(t, os.Stderr, attributionWriter(options{Format: "csv"}))
+	assert.Equal(t, os.Stderr, attributionWriter(options{StdoutTemplate: "cards.tmpl"}))
+	assert.Equal(t, os.Stderr, attributionWriter(options{ShowLangs: true, JSON: true}))
+}
+
 func Test_handleExitSignal(t *testing.T) {
 	oldArgs := os.Args
 	os.Setenv("LU_TEST", "1")
@@ -215,9 +300,45 @@ func Test_Main(t *testing.T) {
 	result = mainWrapper()
 	assert.Contains(t, result, "schwarzer Hund")
 
+	os.Args = []string{"lu", "-fen", "-tde", "--format", "json", "black dog"}
+	result = mainWrapper()
+	assert.Contains(t, result, `"translations": [
+          "schwarzer Hund"`)
+	// the attribution doesn't break the document
+	assert.True(t, json.Valid([]byte(result)), result)
+
 	os.Args = []string{"lu", "-fen", "-tde", "-oout.txt", "black dog"}
 	mainWrapper()
 	fcontents, _ := ioutil.ReadFile("out.txt")
 	os.Remove("out.txt")
 	assert.Contains(t, string(fcontents), "schwarzer Hund")
+
+	// results of the next run are merged into the existing html file
+	defer os.Remove("out.html")
+	for _, req := range []string{"black dog", "dog"} {
+		os.Args = []string{"lu", "-fen", "-tde", "-oout.html", req}
+		mainWrapper()
+	}
+	fcontents, _ = ioutil.ReadFile("out.html")
+	assert.Equal(t, 1, strings.Count(string(fcontents), "<html>"))
+	assert.Contains(t, string(fcontents), "schwarzer Hund")
+	assert.Contains(t, string(fcontents), "Rüde")
+
+	// json and jsonl output have the same results, but counts of repeated requests are known
+	// when the whole input is read, so they are written only to the json document, which is written at the end
+	defer os.Remove("in.txt")
+	require.NoError(t, ioutil.WriteFile("in.txt", []byte("black dog\ndog\nBlack dog\n"), 0600))
+	os.Args = []string{"lu", "-fen", "-tde", "-iin.txt", "--format", "json"}
+	var all []*lookup.Entry
+	require.NoError(t, json.Unmarshal([]byte(mainWrapper()), &all))
+	os.Args = []string{"lu", "-fen", "-tde", "-iin.txt", "--format", "jsonl"}
+	streamed, err := (&jsonlDecoder{}).decodeList(strings.NewReader(mainWrapper()))
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, 2, all[0].Count)
+	assert.Equal(t, 3, all[0].LastLine)
+	for _, e := range all {
+		e.Count, e.LastLine = 0, 0
+	}
+	assert.Equal(t, all, streamed)
 }
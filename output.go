@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// checkpointInterval is the minimal interval between writes of the destination file while the lookup runs
+const checkpointInterval = 2 * time.Second
+
+// htmlDataStart and htmlDataEnd surround lookup results embedded into html files as JSON,
+// they are used to merge new results into the existing file
+const (
+	htmlDataStart = `<script type="application/json" id="lu-entries">`
+	htmlDataEnd   = `</script>`
+)
+
+// entryDecoder reads back lookup results rendered by the renderer or the templater,
+// it is used to merge new results into the existing file
+type entryDecoder interface {
+	decodeList(r io.Reader) ([]*lookup.Entry, error)
+}
+
+// prefixDecoder is the entryDecoder of files which can hold other content before lookup results
+type prefixDecoder interface {
+	// prefix returns the content of the file before lookup results
+	prefix(data []byte) []byte
+}
+
+// errNoResults is returned by the decoder if the existing file has no lookup results to merge,
+// e.g. the html file written by the custom template or by older versions, new results are appended to it then
+var errNoResults = errors.New("the file has no embedded lookup results")
+
+// outputFile writes lookup results to the destination file.
+// The file is rewritten atomically, using the temporary file and rename, on checkpoints
+// while the lookup runs and at the end, so a crash loses only the latest results.
+// Results of the existing file are merged with the new ones if its format can be decoded,
+// otherwise new results are appended to its content
+type outputFile struct {
+	name string
+	enc  lookup.Renderer
+	// sorter sorts results, it is nil if they are written in the input order
+	sorter   *entriesSorter
+	interval time.Duration
+	// merged holds results read from the existing file
+	merged []*lookup.Entry
+	// prefix holds the content of the existing file which can't be decoded
+	prefix []byte
+	// pending holds results added since the start
+	pending []*lookup.Entry
+	written time.Time
+	// afterWrite is called with results written to the file, e.g. to save the lookup state
+	afterWrite func(entries []*lookup.Entry) error
+}
+
+// newOutputFile creates the output file, reading results of the existing one with the decoder.
+// If the decoder is nil, new results are appended to the existing content
+func newOutputFile(name string, enc lookup.Renderer, dec entryDecoder, sorter *entriesSorter) (*outputFile, error) {
+	f := &outputFile{name: name, enc: enc, sorter: sorter, interval: checkpointInterval, written: time.Now()}
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return f, nil
+	}
+
+	if dec == nil {
+		f.prefix = data
+		return f, nil
+	}
+	f.merged, err = dec.decodeList(bytes.NewReader(data))
+	if err == errNoResults {
+		f.prefix = data
+		return f, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't merge results into %s", name)
+	}
+	if pd, ok := dec.(prefixDecoder); ok {
+		f.prefix = pd.prefix(data)
+	}
+	return f, nil
+}
+
+// add adds the result and writes the file if the checkpoint interval has passed since the last write
+func (f *outputFile) add(e *lookup.Entry) error {
+	f.pending = append(f.pending, e)
+	if time.Since(f.written) < f.interval {
+		return nil
+	}
+	return f.write(f.pending)
+}
+
+// write rewrites the file with the merged results followed by the new ones, possibly sorted
+func (f *outputFile) write(entries []*lookup.Entry) error {
+	all := append(append([]*lookup.Entry{}, f.merged...), entries...)
+	if f.sorter != nil {
+		f.sorter.sort(all)
+	}
+
+	var b bytes.Buffer
+	b.Write(f.prefix)
+	var err error
+	if enc, ok := f.enc.(lookup.EntryRenderer); ok && len(f.prefix) > 0 {
+		// entries are numbered after the existing content, so headers are not repeated
+		for i, e := range all {
+			if err = enc.RenderEntry(&b, e, i+2); err != nil {
+				break
+			}
+		}
+	} else {
+		err = f.enc.Render(&b, all)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(f.name, b.Bytes()); err != nil {
+		return err
+	}
+	f.written = time.Now()
+	if f.afterWrite != nil {
+		return f.afterWrite(entries)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to the temporary file in the same directory and renames it to the file name,
+// so the file is either replaced completely or left intact
+func writeFileAtomic(name string, data []byte) error {
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(name); err == nil {
+		mode = fi.Mode()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return errors.Wrap(err, "can't write results")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	return errors.Wrap(err, "can't write results")
+}
+
+// writeMissing writes requests which got no translation to some of languages to the file, one per line,
+// so the file can be used as the source file of the next lookup
+func writeMissing(fname string, entries []*lookup.Entry) error {
+	var b bytes.Buffer
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.Missing() && !seen[e.Request] {
+			seen[e.Request] = true
+			b.WriteString(e.Request + "\n")
+		}
+	}
+	return writeFileAtomic(fname, b.Bytes())
+}
+
+// newDecoder returns decoder for the file written by the templater or the renderer,
+// or nil if the file can't be decoded and new results should be appended to it
+func newDecoder(t lookup.Templater, r lookup.Renderer) entryDecoder {
+	switch r.(type) {
+	case *lookup.JSONRenderer:
+		return &jsonDecoder{}
+	case *lookup.JSONLRenderer:
+		return &jsonlDecoder{}
+	}
+	if _, ok := t.(*lookup.HTMLTemplater); ok {
+		return &htmlDecoder{}
+	}
+	return nil
+}
+
+// jsonDecoder implements entryDecoder interface, reading lookup results rendered as the JSON array
+type jsonDecoder struct{}
+
+func (d *jsonDecoder) decodeList(r io.Reader) ([]*lookup.Entry, error) {
+	var entries []*lookup.Entry
+	err := json.NewDecoder(r).Decode(&entries)
+	return entries, err
+}
+
+// jsonlDecoder implements entryDecoder interface, reading lookup results rendered as JSON Lines
+type jsonlDecoder struct{}
+
+func (d *jsonlDecoder) decodeList(r io.Reader) ([]*lookup.Entry, error) {
+	var entries []*lookup.Entry
+	dec := json.NewDecoder(r)
+	for {
+		var e lookup.Entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+}
+
+// htmlDecoder implements entryDecoder interface, reading lookup results embedded into html files
+type htmlDecoder struct{}
+
+func (d *htmlDecoder) decodeList(r io.Reader) ([]*lookup.Entry, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(data, []byte(htmlDataStart))
+	if start == -1 {
+		return nil, errNoResults
+	}
+	data = data[start+len(htmlDataStart):]
+	end := bytes.Index(data, []byte(htmlDataEnd))
+	if end == -1 {
+		return nil, errors.New("embedded lookup results are broken")
+	}
+
+	var entries []*lookup.Entry
+	if err = json.Unmarshal(data[:end], &entries); err != nil {
+		return nil, errors.Wrap(err, "embedded lookup results are broken")
+	}
+	return entries, nil
+}
+
+// prefix returns the content before the html document holding lookup results,
+// it is the content of the file without results, which the document was appended to
+func (d *htmlDecoder) prefix(data []byte) []byte {
+	start := bytes.Index(data, []byte(htmlDataStart))
+	if start == -1 {
+		return nil
+	}
+	if doc := bytes.LastIndex(data[:start], []byte("<html")); doc > 0 {
+		return data[:doc]
+	}
+	return nil
+}
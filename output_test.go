@@ -0,0 +1,192 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withOutputDir calls fn with the temporary directory for output files
+func withOutputDir(t *testing.T, fn func(dir string)) {
+	dir, err := ioutil.TempDir("", "lu-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn(dir)
+}
+
+func Test_outputFile_merge(t *testing.T) {
+	first := []*lookup.Entry{{Request: "dog", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Hund"}}}}}
+	second := []*lookup.Entry{{Request: "cat", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Katze"}}}}}
+
+	withOutputDir(t, func(dir string) {
+		cases := []struct {
+			name string
+			enc  lookup.Renderer
+			dec  entryDecoder
+		}{
+			{"out.html", &lookup.TemplateRenderer{Templater: &lookup.HTMLTemplater{}}, &htmlDecoder{}},
+			{"out.json", &lookup.JSONRenderer{}, &jsonDecoder{}},
+			{"out.jsonl", &lookup.JSONLRenderer{}, &jsonlDecoder{}},
+		}
+		for _, c := range cases {
+			fname := filepath.Join(dir, c.name)
+			for _, entries := range [][]*lookup.Entry{first, second} {
+				f, err := newOutputFile(fname, c.enc, c.dec, newEntriesSorter([]sortKey{{name: sortRequest}}, "en", nil))
+				require.NoError(t, err)
+				require.NoError(t, f.write(entries))
+			}
+
+			f, err := os.Open(fname)
+			require.NoError(t, err)
+			entries, err := c.dec.decodeList(f)
+			f.Close()
+			require.NoError(t, err, c.name)
+			require.Len(t, entries, 2, c.name)
+			// results are sorted together
+			assert.Equal(t, "cat", entries[0].Request, c.name)
+			assert.Equal(t, "dog", entries[1].Request, c.name)
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "out.html"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(string(b), "<html>"))
+	})
+}
+
+func Test_outputFile_append(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		fname := filepath.Join(dir, "out.csv")
+		for _, req := range []string{"dog", "cat"} {
+			f, err := newOutputFile(fname, &lookup.CSVRenderer{Comma: ','}, nil, nil)
+			require.NoError(t, err)
+			require.NoError(t, f.write([]*lookup.Entry{{Request: req, Responses: []*lookup.Response{{Lang: "de"}}}}))
+		}
+		b, err := ioutil.ReadFile(fname)
+		require.NoError(t, err)
+		assert.Equal(t, "request,from,lang,status,transcription,pos,translations,meta\ndog,,de,,,,,\ncat,,de,,,,,\n", string(b))
+
+		fname = filepath.Join(dir, "out.txt")
+		require.NoError(t, ioutil.WriteFile(fname, []byte("notes\n"), 0644))
+		f, err := newOutputFile(fname, &lookup.TemplateRenderer{Templater: &textTemplater{}}, nil, nil)
+		require.NoError(t, err)
+		require.NoError(t, f.write([]*lookup.Entry{{Request: "dog"}}))
+		b, err = ioutil.ReadFile(fname)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(b), "notes\ndog\n"))
+
+		// the file mode is kept
+		fi, err := os.Stat(fname)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0644), fi.Mode())
+	})
+}
+
+func Test_newOutputFile_errors(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		fname := filepath.Join(dir, "out.json")
+		require.NoError(t, ioutil.WriteFile(fname, []byte(`{"not": "lu"}`), 0600))
+		_, err := newOutputFile(fname, &lookup.JSONRenderer{}, &jsonDecoder{}, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't merge results into "+fname)
+
+		fname = filepath.Join(dir, "out.html")
+		require.NoError(t, ioutil.WriteFile(fname, []byte(htmlDataStart+`[{"request": `), 0600))
+		_, err = newOutputFile(fname, &lookup.TemplateRenderer{Templater: &lookup.HTMLTemplater{}}, &htmlDecoder{}, nil)
+		assert.Contains(t, err.Error(), "embedded lookup results are broken")
+
+		// the empty file is just overwritten
+		require.NoError(t, ioutil.WriteFile(fname, nil, 0600))
+		f, err := newOutputFile(fname, &lookup.TemplateRenderer{Templater: &lookup.HTMLTemplater{}}, &htmlDecoder{}, nil)
+		require.NoError(t, err)
+		assert.Nil(t, f.merged)
+		assert.Nil(t, f.prefix)
+	})
+}
+
+func Test_newOutputFile_htmlWithoutResults(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		// the file written by the custom template or by older versions has no embedded results,
+		// new results are appended to it
+		fname := filepath.Join(dir, "out.html")
+		old := "<html><body>dog</body></html>\n"
+		require.NoError(t, ioutil.WriteFile(fname, []byte(old), 0600))
+		r := &lookup.TemplateRenderer{Templater: &lookup.HTMLTemplater{}}
+		f, err := newOutputFile(fname, r, &htmlDecoder{}, nil)
+		require.NoError(t, err)
+		assert.Nil(t, f.merged)
+		require.NoError(t, f.write([]*lookup.Entry{{Request: "cat"}}))
+		assert.True(t, strings.HasPrefix(string(mustReadFile(t, fname)), old))
+
+		// and the content is kept when next results are merged
+		f, err = newOutputFile(fname, r, &htmlDecoder{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, old, string(f.prefix))
+		require.Len(t, f.merged, 1)
+		require.NoError(t, f.write([]*lookup.Entry{{Request: "fox"}}))
+		data := string(mustReadFile(t, fname))
+		assert.True(t, strings.HasPrefix(data, old))
+		assert.Equal(t, 1, strings.Count(data, htmlDataStart))
+		entries, err := (&htmlDecoder{}).decodeList(strings.NewReader(data))
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "fox", entries[1].Request)
+	})
+}
+
+func Test_outputFile_add(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		fname := filepath.Join(dir, "out.jsonl")
+		f, err := newOutputFile(fname, &lookup.JSONLRenderer{}, &jsonlDecoder{}, nil)
+		require.NoError(t, err)
+
+		// nothing is written until the checkpoint interval passes
+		f.interval = time.Hour
+		require.NoError(t, f.add(&lookup.Entry{Request: "dog"}))
+		_, err = os.Stat(fname)
+		assert.True(t, os.IsNotExist(err))
+
+		f.interval = 0
+		require.NoError(t, f.add(&lookup.Entry{Request: "cat"}))
+		b, err := ioutil.ReadFile(fname)
+		require.NoError(t, err)
+		assert.Equal(t, 2, strings.Count(string(b), "\n"))
+
+		// no temporary files are left
+		files, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, files, 1)
+	})
+}
+
+func Test_newDecoder(t *testing.T) {
+	assert.Equal(t, &jsonDecoder{}, newDecoder(nil, &lookup.JSONRenderer{}))
+	assert.Equal(t, &jsonlDecoder{}, newDecoder(nil, &lookup.JSONLRenderer{}))
+	assert.Equal(t, &htmlDecoder{}, newDecoder(&lookup.HTMLTemplater{}, nil))
+	assert.Nil(t, newDecoder(&textTemplater{}, nil))
+	assert.Nil(t, newDecoder(nil, &lookup.CSVRenderer{}))
+	assert.Nil(t, newDecoder(&customTemplater{base: &lookup.HTMLTemplater{}}, nil))
+}
+
+func Test_writeMissing(t *testing.T) {
+	entries := []*lookup.Entry{
+		{Request: "dog", Responses: []*lookup.Response{{Lang: "de", Status: lookup.StatusDictionary}, {Lang: "it", Status: lookup.StatusNotFound}}},
+		{Request: "cat", Responses: []*lookup.Response{{Lang: "de", Status: lookup.StatusTranslation}}},
+		{Request: "xyz", Responses: []*lookup.Response{{Lang: "de", Status: lookup.StatusError, Error: "(413) text is too long"}}},
+		{Request: "dog", Responses: []*lookup.Response{{Lang: "it", Status: lookup.StatusNotFound}}},
+	}
+
+	withOutputDir(t, func(dir string) {
+		fname := filepath.Join(dir, "missing.txt")
+		require.NoError(t, writeMissing(fname, entries))
+		b, err := ioutil.ReadFile(fname)
+		require.NoError(t, err)
+		assert.Equal(t, "dog\nxyz\n", string(b))
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dafanasev/lu/internal/mock"
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// defaultProvider is the name of the provider used if none is specified
+const defaultProvider = "yandex"
+
+// providerFactory creates the provider, using settings from the parsed options
+type providerFactory func(opts *options) (*lookup.Provider, error)
+
+// providers is the registry of all supported providers, indexed by their names
+var providers = map[string]providerFactory{
+	"yandex":         newYandexProvider,
+	"libretranslate": newLibreTranslateProvider,
+	"dictd":          newDictdProvider,
+	"mock":           newMockProvider,
+}
+
+// newProvider creates the provider registered under the name
+func newProvider(name string, opts *options) (*lookup.Provider, error) {
+	factory, ok := providers[name]
+	if !ok {
+		return nil, errors.Errorf("unknown provider %s, supported ones are: %s", name, strings.Join(providerNames(), ", "))
+	}
+
+	p, err := factory(opts)
+	if err != nil {
+		return nil, err
+	}
+	p.Name = name
+	return p, nil
+}
+
+// providerNames returns sorted names of all registered providers
+func providerNames() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newYandexProvider creates the provider using Yandex.Dictionary and Yandex.Translate,
+// API keys are taken from flags, environment variables or the config file
+func newYandexProvider(opts *options) (*lookup.Provider, error) {
+	if opts.YandexDictKey == "" {
+		return nil, errors.New("Yandex.Dictionary API key is not set, use the LU_YANDEX_DICTIONARY_API_KEY environment variable or the yandex-dictionary-key config option")
+	}
+	if opts.YandexTranslateKey == "" {
+		return nil, errors.New("Yandex.Translate API key is not set, use the LU_YANDEX_TRANSLATE_API_KEY environment variable or the yandex-translate-key config option")
+	}
+	return lookup.NewYandex(opts.YandexDictKey, opts.YandexTranslateKey, opts.DictUI), nil
+}
+
+// newLibreTranslateProvider creates the provider using LibreTranslate compatible server
+func newLibreTranslateProvider(opts *options) (*lookup.Provider, error) {
+	if opts.LibreTranslateURL == "" {
+		return nil, errors.New("LibreTranslate server URL is not set")
+	}
+	return lookup.NewLibreTranslate(opts.LibreTranslateURL, opts.LibreTranslateKey), nil
+}
+
+// newDictdProvider creates the provider using DICT protocol server,
+// databases are specified as direction=database, e.g. en-de=fd-eng-deu
+func newDictdProvider(opts *options) (*lookup.Provider, error) {
+	if opts.DictServer == "" {
+		return nil, errors.New("DICT server address is not set")
+	}
+
+	databases := make(map[string]string, len(opts.DictDatabases))
+	for _, db := range opts.DictDatabases {
+		parts := strings.SplitN(db, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("wrong DICT database %s, it must be specified as direction=database, e.g. en-de=fd-eng-deu", db)
+		}
+		databases[parts[0]] = parts[1]
+	}
+	return lookup.NewDictd(opts.DictServer, databases), nil
+}
+
+// newMockProvider creates the mock provider, which knows only a few requests,
+// it can be used for debug purposes by setting LU_TEST environment variable to 1
+func newMockProvider(opts *options) (*lookup.Provider, error) {
+	if os.Getenv("LU_TEST") != "1" {
+		return nil, errors.New("mock provider is available only if LU_TEST environment variable is set to 1")
+	}
+	return mock.New(), nil
+}
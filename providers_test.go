@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newProvider(t *testing.T) {
+	_, err := newProvider("unknown", &options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown provider unknown, supported ones are: dictd, libretranslate, mock, yandex")
+
+	_, err = newProvider("mock", &options{})
+	require.Error(t, err)
+
+	os.Setenv("LU_TEST", "1")
+	defer os.Unsetenv("LU_TEST")
+	p, err := newProvider("mock", &options{})
+	require.NoError(t, err)
+	assert.Equal(t, "mock", p.Name)
+	assert.NotNil(t, p.Dictionary)
+	assert.NotNil(t, p.Translator)
+}
+
+func Test_newYandexProvider(t *testing.T) {
+	_, err := newYandexProvider(&options{YandexTranslateKey: "translate"})
+	require.Error(t, err)
+	_, err = newYandexProvider(&options{YandexDictKey: "dict"})
+	require.Error(t, err)
+
+	p, err := newYandexProvider(&options{YandexDictKey: "dict", YandexTranslateKey: "translate"})
+	require.NoError(t, err)
+	assert.NotNil(t, p.Dictionary)
+	assert.NotNil(t, p.Translator)
+}
+
+func Test_newLibreTranslateProvider(t *testing.T) {
+	_, err := newLibreTranslateProvider(&options{})
+	require.Error(t, err)
+
+	p, err := newLibreTranslateProvider(&options{LibreTranslateURL: "http://localhost:5000/"})
+	require.NoError(t, err)
+	assert.Nil(t, p.Dictionary)
+}
+
+func Test_newDictdProvider(t *testing.T) {
+	_, err := newDictdProvider(&options{})
+	require.Error(t, err)
+
+	_, err = newDictdProvider(&options{DictServer: "localhost:2628", DictDatabases: []string{"en-de"}})
+	assert.EqualError(t, err, "wrong DICT database en-de, it must be specified as direction=database, e.g. en-de=fd-eng-deu")
+
+	p, err := newDictdProvider(&options{DictServer: "localhost:2628", DictDatabases: []string{"en-de=custom"}})
+	require.NoError(t, err)
+	assert.Nil(t, p.Translator)
+}
+
+func Test_providerNames(t *testing.T) {
+	assert.Equal(t, []string{"dictd", "libretranslate", "mock", "yandex"}, providerNames())
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// maxReplHistory is the number of input history lines loaded on start of the interactive mode
+const maxReplHistory = 1000
+
+// replCommands holds descriptions of the interactive mode commands
+var replCommands = map[string]string{
+	":to":    ":to LANG...   set languages to translate to, e.g. :to de it",
+	":from":  ":from LANG    set language to translate from, e.g. :from en",
+	":save":  ":save FILE    write results of the session to the file, e.g. :save out.html",
+	":sort":  ":sort [keys]  toggle sorting of the saved results or sort them by keys, e.g. :sort -count request",
+	":help":  ":help         show this help",
+	":quit":  ":quit         quit, Ctrl-D does the same",
+	":langs": ":langs        show supported languages",
+}
+
+// defaultReplHistory returns the file to keep interactive mode input history in, if it isn't specified explicitly
+func defaultReplHistory() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "lu", "repl_history")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "share", "lu", "repl_history")
+}
+
+// interactive reports whether lu should run in the interactive mode,
+// i.e. requests are read from stdin and both stdin and stdout are terminals
+func (lu *Lu) interactive() bool {
+	return !lu.opts.NoInteractive && lu.stdin && isTerminal(os.Stdin.Fd()) && isTerminal(os.Stdout.Fd())
+}
+
+// repl runs the interactive session: it reads requests and commands from the terminal,
+// looks requests up and prints results until the user quits or the done channel is closed
+func (lu *Lu) repl(done chan struct{}) error {
+	ed := newLineEditor(os.Stdin, os.Stdout)
+	ed.history = loadReplHistory(lu.opts.ReplHistory)
+	ed.complete = lu.completions
+
+	fmt.Println("Type words to look them up, :help to list commands, :quit or Ctrl-D to quit")
+	for n := 0; ; {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+
+		restore, err := makeRaw(os.Stdin.Fd())
+		if err != nil {
+			return errors.Wrap(err, "can't switch terminal to raw mode")
+		}
+		line, err := ed.readLineUntil(lu.prompt(), done)
+		restore()
+
+		if isClosed(done) {
+			// the prompt of the abandoned read is ended, so the shell prompt starts at the new line
+			fmt.Println()
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		ed.addHistory(line)
+		appendReplHistory(lu.opts.ReplHistory, line)
+
+		if strings.HasPrefix(line, ":") {
+			quit, err := lu.replCommand(line, os.Stdout)
+			if err != nil {
+				fmt.Println(err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+
+		entry, err := lu.lookupEntry(context.Background(), line)
+		if err != nil {
+			// the session can't go on if no lookup can succeed, e.g. the API key is invalid
+			if lookup.KindOf(err) == lookup.ErrFatal {
+				return err
+			}
+			fmt.Println(err)
+			continue
+		}
+		n++
+		printResults(lu, entry, n)
+		lu.history = append(lu.history, entry)
+		if err = lu.checkpoint(entry); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// prompt returns the interactive mode prompt, showing the translation direction
+func (lu *Lu) prompt() string {
+	return fmt.Sprintf("%s-%s> ", lu.opts.FromLang, strings.Join(lu.opts.ToLangs, ","))
+}
+
+// replCommand runs the interactive mode command, changing options of lu,
+// it returns true if the user wants to quit
+func (lu *Lu) replCommand(line string, w io.Writer) (bool, error) {
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+
+	switch cmd {
+	case ":quit", ":q", ":exit":
+		return true, nil
+	case ":to":
+		if len(args) == 0 {
+			return false, errors.New("languages to translate to must be specified, e.g. :to de it")
+		}
+		if err := lu.setLangs(context.Background(), w, lu.opts.FromLang, args); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(w, "Translating to %s\n", strings.Join(args, ", "))
+	case ":from":
+		if len(args) != 1 {
+			return false, errors.New("the single language to translate from must be specified, e.g. :from en")
+		}
+		if err := lu.setLangs(context.Background(), w, args[0], lu.opts.ToLangs); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(w, "Translating from %s\n", args[0])
+	case ":save":
+		if len(args) != 1 {
+			return false, errors.New("file name must be specified, e.g. :save out.html")
+		}
+		if err := lu.save(args[0]); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(w, "Saved %d results to %s\n", len(lu.history), args[0])
+	case ":sort":
+		switch {
+		case len(args) > 0:
+			spec := strings.Join(args, ",")
+			if _, err := parseSortKeys(spec); err != nil {
+				return false, err
+			}
+			lu.opts.Sort = spec
+		case lu.opts.Sort == "":
+			lu.opts.Sort = sortRequest
+		default:
+			lu.opts.Sort = ""
+		}
+		if lu.opts.Sort != "" {
+			fmt.Fprintf(w, "Saved results will be sorted by %s\n", lu.opts.Sort)
+		} else {
+			fmt.Fprintln(w, "Saved results will be in the lookup order")
+		}
+	case ":langs":
+		langs, err := lu.supportedLangs(context.Background(), lu.opts.LangsUI)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(w, strings.Join(langs, "\n"))
+	case ":help":
+		var help []string
+		for _, h := range replCommands {
+			help = append(help, h)
+		}
+		sort.Strings(help)
+		fmt.Fprintln(w, strings.Join(help, "\n"))
+	default:
+		return false, errors.Errorf("unknown command %s, type :help to list commands", cmd)
+	}
+	return false, nil
+}
+
+// setLangs sets languages to translate from and to, checking them like the ones of the command line,
+// so the unknown language is reported at once rather than by the next lookup. Languages are kept if the check fails
+func (lu *Lu) setLangs(ctx context.Context, w io.Writer, from string, to []string) error {
+	old := lu.opts
+	lu.opts.FromLang, lu.opts.ToLangs = from, to
+	if err := lu.checkLangs(ctx, w); err != nil {
+		lu.opts = old
+		return err
+	}
+	return nil
+}
+
+// save writes the history, possibly sorted, to the file, replacing its content.
+// Format is taken from the format option or from the file extension
+func (lu *Lu) save(fname string) error {
+	t, enc, err := newFileOutput(fname, lu.opts.Format, lu.opts.Template, lu.opts.TemplatesDir)
+	if err != nil {
+		return err
+	}
+	if enc == nil {
+		enc = &lookup.TemplateRenderer{Templater: t}
+	}
+	sorter, err := lu.sorter()
+	if err != nil {
+		return err
+	}
+	if sorter != nil {
+		sorter.sort(lu.history)
+	}
+
+	var b bytes.Buffer
+	if err = enc.Render(&b, lu.history); err != nil {
+		return err
+	}
+	return writeFileAtomic(fname, b.Bytes())
+}
+
+// completions returns previously looked up requests or commands starting with the prefix
+func (lu *Lu) completions(prefix string) []string {
+	var candidates []string
+	if strings.HasPrefix(prefix, ":") {
+		for cmd := range replCommands {
+			if strings.HasPrefix(cmd, prefix) {
+				candidates = append(candidates, cmd)
+			}
+		}
+		return candidates
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range lu.history {
+		if !seen[e.Request] && strings.HasPrefix(e.Request, prefix) {
+			seen[e.Request] = true
+			candidates = append(candidates, e.Request)
+		}
+	}
+	return candidates
+}
+
+// loadReplHistory returns last lines of the input history file
+func loadReplHistory(fname string) []string {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if len(lines) > maxReplHistory {
+		lines = lines[len(lines)-maxReplHistory:]
+	}
+	return lines
+}
+
+// appendReplHistory appends the line to the input history file, errors are ignored
+// because failure to keep the history must not break the session
+func appendReplHistory(fname, line string) {
+	if fname == "" {
+		return
+	}
+	os.MkdirAll(filepath.Dir(fname), 0700)
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dafanasev/lu/internal/mock"
+	"github.com/dafanasev/lu/lookup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Lu_prompt(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de", "fr"}}}
+	assert.Equal(t, "en-de,fr> ", lu.prompt())
+}
+
+func Test_Lu_replCommand(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}, LangsUI: "en"}, client: newMockClient(t, lookup.Options{})}
+	w := &bytes.Buffer{}
+
+	quit, err := lu.replCommand(":to it de", w)
+	require.NoError(t, err)
+	assert.False(t, quit)
+	assert.Equal(t, []string{"it", "de"}, lu.opts.ToLangs)
+
+	_, err = lu.replCommand(":to", w)
+	assert.Error(t, err)
+
+	_, err = lu.replCommand(":from de", w)
+	require.NoError(t, err)
+	assert.Equal(t, "de", lu.opts.FromLang)
+
+	_, err = lu.replCommand(":from", w)
+	assert.Error(t, err)
+
+	// languages are checked when they are set and kept if they are unknown
+	_, err = lu.replCommand(":to xx", w)
+	assert.EqualError(t, err, "unknown language xx")
+	assert.Equal(t, []string{"it", "de"}, lu.opts.ToLangs)
+	_, err = lu.replCommand(":from dee", w)
+	assert.EqualError(t, err, "unknown language dee, did you mean de (german)?")
+	assert.Equal(t, "de", lu.opts.FromLang)
+	_, err = lu.replCommand(":from auto", w)
+	require.NoError(t, err)
+	assert.Equal(t, "auto", lu.opts.FromLang)
+
+	// language names are shown in the language of the interface
+	w.Reset()
+	_, err = lu.replCommand(":langs", w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "de: german")
+	lu.opts.LangsUI = "ru"
+	_, err = lu.replCommand(":langs", w)
+	assert.Error(t, err)
+
+	_, err = lu.replCommand(":sort", w)
+	require.NoError(t, err)
+	assert.Equal(t, "request", lu.opts.Sort)
+	_, err = lu.replCommand(":sort", w)
+	require.NoError(t, err)
+	assert.Equal(t, "", lu.opts.Sort)
+	_, err = lu.replCommand(":sort -count request", w)
+	require.NoError(t, err)
+	assert.Equal(t, "-count,request", lu.opts.Sort)
+	_, err = lu.replCommand(":sort size", w)
+	assert.EqualError(t, err, "unknown sort key size, use request, translation, from, count or line")
+
+	w.Reset()
+	_, err = lu.replCommand(":help", w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), ":save FILE")
+
+	// the provider without translator can't list languages
+	lu.client = newTestClient(t, mock.New().Dictionary, nil, lookup.Options{})
+	_, err = lu.replCommand(":langs", w)
+	assert.Error(t, err)
+
+	_, err = lu.replCommand(":unknown", w)
+	assert.EqualError(t, err, "unknown command :unknown, type :help to list commands")
+
+	for _, cmd := range []string{":quit", ":q", ":exit"} {
+		quit, err = lu.replCommand(cmd, w)
+		require.NoError(t, err)
+		assert.True(t, quit)
+	}
+}
+
+func Test_Lu_replCommand_save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lu")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}}}
+	lu.client = newMockClient(t, lookup.Options{})
+	for _, req := range []string{"dog", "black dog"} {
+		e, err := lu.lookupEntry(context.Background(), req)
+		require.NoError(t, err)
+		lu.history = append(lu.history, e)
+	}
+
+	w := &bytes.Buffer{}
+	_, err = lu.replCommand(":save", w)
+	assert.Error(t, err)
+
+	fname := filepath.Join(dir, "out.html")
+	// the file is rewritten, not appended to
+	for i := 0; i < 2; i++ {
+		_, err = lu.replCommand(":save "+fname, w)
+		require.NoError(t, err)
+	}
+	b, err := ioutil.ReadFile(fname)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(b), "<html"))
+	assert.Contains(t, string(b), "schwarzer Hund")
+
+	fname = filepath.Join(dir, "out.csv")
+	_, err = lu.replCommand(":save "+fname, w)
+	require.NoError(t, err)
+	b, err = ioutil.ReadFile(fname)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "request,from,lang"))
+
+	_, err = lu.replCommand(":save "+filepath.Join(dir, "out.apkg"), w)
+	assert.Error(t, err)
+}
+
+func Test_Lu_lookupEntry(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de", "fr"}}}
+	lu.client = newMockClient(t, lookup.Options{})
+
+	e, err := lu.lookupEntry(context.Background(), "dog")
+	require.NoError(t, err)
+	assert.Equal(t, "dog", e.Request)
+	require.Len(t, e.Responses, 2)
+	assert.Equal(t, "de", e.Responses[0].Lang)
+	assert.Equal(t, "fr", e.Responses[1].Lang)
+}
+
+func Test_Lu_completions(t *testing.T) {
+	lu := &Lu{history: []*lookup.Entry{{Request: "dog"}, {Request: "dolphin"}, {Request: "dog"}, {Request: "cat"}}}
+	assert.Equal(t, []string{"dog", "dolphin"}, lu.completions("do"))
+	assert.Empty(t, lu.completions("x"))
+	assert.Equal(t, []string{":sort"}, lu.completions(":so"))
+}
+
+func Test_replHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lu")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "lu", "repl_history")
+	assert.Nil(t, loadReplHistory(fname))
+
+	appendReplHistory(fname, "dog")
+	appendReplHistory(fname, "cat")
+	assert.Equal(t, []string{"dog", "cat"}, loadReplHistory(fname))
+
+	for i := 0; i < maxReplHistory; i++ {
+		appendReplHistory(fname, "bird")
+	}
+	lines := loadReplHistory(fname)
+	assert.Len(t, lines, maxReplHistory)
+	assert.Equal(t, "bird", lines[0])
+}
+
+func Test_defaultReplHistory(t *testing.T) {
+	xdg := os.Getenv("XDG_DATA_HOME")
+	defer os.Setenv("XDG_DATA_HOME", xdg)
+
+	os.Setenv("XDG_DATA_HOME", "/data")
+	assert.Equal(t, filepath.Join("/data", "lu", "repl_history"), defaultReplHistory())
+	os.Setenv("XDG_DATA_HOME", "")
+	assert.Equal(t, filepath.Join(os.Getenv("HOME"), ".local", "share", "lu", "repl_history"), defaultReplHistory())
+}
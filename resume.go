@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// stateFileSuffix is added to the destination file name to get the name of the file
+// keeping the state of the lookup of the source file
+const stateFileSuffix = ".lu-state"
+
+// resumeState holds the progress of the lookup of the source file,
+// it is written next to the destination file along with it and removed when the lookup is completed
+type resumeState struct {
+	Source string   `json:"source"`
+	Hash   string   `json:"hash"`
+	From   string   `json:"from"`
+	To     []string `json:"to"`
+	// Line is the number of the last source line which results are written to the destination file
+	Line    int       `json:"line"`
+	Updated time.Time `json:"updated"`
+
+	file string
+}
+
+// setupResume sets up the state of the lookup if both source and destination files are specified.
+// If the resume option is set, the state of the interrupted lookup is loaded and lines it processed are skipped
+func (lu *Lu) setupResume() error {
+	if lu.srcFile == nil || lu.dst == nil {
+		return nil
+	}
+
+	hash, err := hashFile(lu.opts.SrcFileName)
+	if err != nil {
+		return err
+	}
+	lu.state = &resumeState{
+		Source: lu.opts.SrcFileName,
+		Hash:   hash,
+		From:   lu.opts.FromLang,
+		To:     lu.opts.ToLangs,
+		file:   lu.opts.DstFileName + stateFileSuffix,
+	}
+
+	if lu.opts.Resume {
+		saved, err := loadState(lu.state.file)
+		if err != nil {
+			return err
+		}
+		if saved.Hash != lu.state.Hash {
+			return errors.Errorf("source file %s has changed since the interrupted lookup, run lu without --resume to start over", lu.opts.SrcFileName)
+		}
+		if saved.From != lu.state.From || strings.Join(saved.To, ",") != strings.Join(lu.state.To, ",") {
+			return errors.Errorf("the interrupted lookup was from %s to %s, use the same languages to resume it",
+				saved.From, strings.Join(saved.To, ", "))
+		}
+		lu.state.Line = saved.Line
+		lu.skipLines = saved.Line
+	}
+
+	lu.dst.afterWrite = lu.saveState
+	return nil
+}
+
+// saveState records the last source line which results are all written to the destination file.
+// Lines of entries can't be used, as the sentence starts at the line before the written ones
+// and the line split into words or parts can be written partially
+func (lu *Lu) saveState(entries []*lookup.Entry) error {
+	lu.doneMu.Lock()
+	for _, e := range entries {
+		if line := lu.doneLines[e]; line > lu.state.Line {
+			lu.state.Line = line
+		}
+	}
+	lu.doneMu.Unlock()
+	lu.state.Updated = time.Now()
+
+	data, err := json.MarshalIndent(lu.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(writeFileAtomic(lu.state.file, data), "can't save lookup state")
+}
+
+// removeState removes the state file when the lookup of the source file is completed
+func (lu *Lu) removeState() error {
+	err := os.Remove(lu.state.file)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "can't remove lookup state")
+	}
+	return nil
+}
+
+// loadState reads the state of the interrupted lookup
+func loadState(fname string) (*resumeState, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("there is nothing to resume, state file %s doesn't exist", fname)
+		}
+		return nil, errors.Wrap(err, "can't read lookup state")
+	}
+
+	state := &resumeState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, errors.Wrapf(err, "lookup state file %s is broken", fname)
+	}
+	return state, nil
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the file content
+func hashFile(fname string) (string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
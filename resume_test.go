@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Lu_setupResume(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		src := filepath.Join(dir, "words.txt")
+		dst := filepath.Join(dir, "words.json")
+		require.NoError(t, ioutil.WriteFile(src, []byte("dog\ncat\n"), 0644))
+
+		newTestLu := func(resume bool, to ...string) (*Lu, error) {
+			lu := &Lu{opts: options{FromLang: "en", ToLangs: to, SrcFileName: src, DstFileName: dst, Resume: resume}}
+			var err error
+			lu.srcFile, err = os.Open(src)
+			require.NoError(t, err)
+			defer lu.close()
+			lu.dst, err = newOutputFile(dst, &lookup.JSONRenderer{}, &jsonDecoder{}, nil)
+			require.NoError(t, err)
+			return lu, lu.setupResume()
+		}
+
+		_, err := newTestLu(true, "de")
+		assert.EqualError(t, err, "there is nothing to resume, state file "+dst+stateFileSuffix+" doesn't exist")
+
+		// the state is saved along with results
+		lu, err := newTestLu(false, "de")
+		require.NoError(t, err)
+		dog := &lookup.Entry{Request: "dog", Line: 1}
+		lu.doneLines = map[*lookup.Entry]int{dog: 1}
+		require.NoError(t, lu.dst.write([]*lookup.Entry{dog}))
+		state, err := loadState(dst + stateFileSuffix)
+		require.NoError(t, err)
+		assert.Equal(t, 1, state.Line)
+		assert.Equal(t, []string{"de"}, state.To)
+
+		lu, err = newTestLu(true, "de")
+		require.NoError(t, err)
+		assert.Equal(t, 1, lu.skipLines)
+
+		_, err = newTestLu(true, "it")
+		assert.EqualError(t, err, "the interrupted lookup was from en to de, use the same languages to resume it")
+
+		require.NoError(t, ioutil.WriteFile(src, []byte("dog\ncat\nfox\n"), 0644))
+		_, err = newTestLu(true, "de")
+		assert.EqualError(t, err, "source file "+src+" has changed since the interrupted lookup, run lu without --resume to start over")
+	})
+}
+
+func Test_Lu_lookupCycle_resume(t *testing.T) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}}, skipLines: 2}
+	lu.client = newMockClient(t, lookup.Options{})
+	lu.input = newTextReader(strings.NewReader("dog\n\nblack dog\n\ncat\n"), false)
+
+	ch := make(chan *lookup.Entry)
+	go lu.lookupCycle(make(chan struct{}), ch)
+	var entries []*lookup.Entry
+	for e := range ch {
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, "black dog", entries[0].Request)
+	assert.Equal(t, 3, entries[0].Line)
+	assert.Equal(t, "cat", entries[1].Request)
+	assert.Equal(t, 5, entries[1].Line)
+	assert.True(t, lu.completed)
+}
+
+func Test_Lu_lookupCycle_doneLines(t *testing.T) {
+	doneLines := func(seg segmenter, input string) map[string]int {
+		lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}}, segmenter: seg}
+		lu.client = newMockClient(t, lookup.Options{})
+		lu.input = newTextReader(strings.NewReader(input), false)
+		ch := make(chan *lookup.Entry)
+		go lu.lookupCycle(make(chan struct{}), ch)
+		var entries []*lookup.Entry
+		for e := range ch {
+			entries = append(entries, e)
+		}
+		lines := make(map[string]int)
+		for _, e := range entries {
+			lines[e.Request] = lu.doneLines[e]
+		}
+		return lines
+	}
+
+	// the line is complete when its last word is passed
+	assert.Equal(t, map[string]int{"dog": 0, "cat": 1, "fox": 2}, doneLines(&wordSegmenter{}, "dog cat\nfox\n"))
+	// and when the sentence started at it and the ones continued at the next line are passed
+	assert.Equal(t, map[string]int{"Dogs bark.": 0, "Cats sleep at night.": 2, "Foxes run.": 3},
+		doneLines(&sentenceSegmenter{}, "Dogs bark. Cats sleep\nat night.\nFoxes run.\n"))
+}
+
+func Test_Lu_writeFile_state(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		dst := filepath.Join(dir, "words.json")
+		lu := &Lu{history: []*lookup.Entry{{Request: "dog", Line: 3}}}
+		lu.doneLines = map[*lookup.Entry]int{lu.history[0]: 3}
+		lu.state = &resumeState{Line: 2, file: dst + stateFileSuffix}
+		var err error
+		lu.dst, err = newOutputFile(dst, &lookup.JSONRenderer{}, &jsonDecoder{}, nil)
+		require.NoError(t, err)
+		lu.dst.afterWrite = lu.saveState
+
+		// the state of the interrupted lookup is kept
+		require.NoError(t, lu.writeFile())
+		state, err := loadState(lu.state.file)
+		require.NoError(t, err)
+		assert.Equal(t, 3, state.Line)
+
+		// and removed when it is completed
+		lu.completed = true
+		require.NoError(t, lu.writeFile())
+		_, err = os.Stat(lu.state.file)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func Test_hashFile(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		fname := filepath.Join(dir, "words.txt")
+		require.NoError(t, ioutil.WriteFile(fname, []byte("dog\n"), 0644))
+		hash, err := hashFile(fname)
+		require.NoError(t, err)
+		assert.Equal(t, "b6d8423f6d3423aa233428ab590600486926cf3cd673ab5879d0d36e2dab2671", hash)
+
+		_, err = hashFile(filepath.Join(dir, "nonexistent"))
+		assert.Error(t, err)
+	})
+}
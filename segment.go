@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// input segmentation modes
+const (
+	splitLine      = "line"
+	splitWord      = "word"
+	splitSentence  = "sentence"
+	splitDelimiter = "delimiter"
+)
+
+// wordRe matches words, which can contain apostrophes and hyphens inside, e.g. don't or well-known
+var wordRe = regexp.MustCompile(`[\p{L}\p{M}]+(?:['’-][\p{L}\p{M}]+)*`)
+
+// sentenceEndRe matches the end of the sentence: terminal punctuation, possibly followed by closing quotes or brackets,
+// and spaces
+var sentenceEndRe = regexp.MustCompile(`[.!?…]+["'»”)\]]*\s+`)
+
+// stopwords holds built-in lists of the most common words, which are not looked up in the word mode
+var stopwords = map[string]string{
+	"en": "a an and are as at be but by for from had has have he her his i if in is it its me my no not of on or " +
+		"our she so than that the their them then there they this to was we were what when which who will with you your",
+	"de": "aber als am an auch auf aus bei bin bis das dass dem den der des die du ein eine einem einen einer es " +
+		"für hat ich ihr im in ist ja mit nicht noch nur oder sie sind so und von war was wie wir zu zum zur",
+	"es": "a al como con de del el ella en es este esta la las le lo los me mi no o para pero por que se si su sus " +
+		"te tu un una y ya yo",
+	"fr": "à au aux avec ce ces dans de des du elle en est et il ils je la le les leur ma mais me mon ne nous on ou " +
+		"par pas pour qu que qui sa se ses son sur ta te tu un une vous y",
+	"it": "a al alla che chi con da dei del della di e è gli ha ho i il in io la le lo ma mi nel non per più se si " +
+		"sono su tu un una",
+	"ru": "а без в во вы да для до его ее её же за и из или им их к как ли мы на не ни но о об он она они от по " +
+		"при с со та то ты у что это я",
+}
+
+// stopwordSets holds built-in lists of stopwords as sets, indexed by languages
+var stopwordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(stopwords))
+	for lang, words := range stopwords {
+		sets[lang] = make(map[string]bool)
+		for _, w := range strings.Fields(words) {
+			sets[lang][w] = true
+		}
+	}
+	return sets
+}()
+
+// segment is the part of the input looked up as the single request
+type segment struct {
+	text string
+	// src is the record of the data source the segment starts at
+	src *record
+	// context holds the source line containing the segment, if the segment is its part
+	context string
+}
+
+// segmenter splits input lines into segments
+type segmenter interface {
+	// add adds the record and returns segments which are complete
+	add(rec *record) []*segment
+	// flush returns the rest of segments at the end of the input
+	flush() []*segment
+	// buffered returns the record the incomplete segment starts at, or nil if all added records are segmented
+	buffered() *record
+}
+
+// newSegmenter creates the segmenter for the split mode set by options
+func newSegmenter(opts *options) (segmenter, error) {
+	switch opts.Split {
+	case "", splitLine:
+		return &lineSegmenter{}, nil
+	case splitWord:
+		s := &wordSegmenter{stopwords: make(map[string]bool)}
+		if opts.KeepStopwords {
+			return s, nil
+		}
+		// the language of each line is guessed if the source one is detected
+		s.detect = opts.FromLang == "" || opts.FromLang == lookup.AutoLang
+		for w := range stopwordSets[opts.FromLang] {
+			s.stopwords[w] = true
+		}
+		if opts.StopwordsFile != "" {
+			words, err := readStopwords(opts.StopwordsFile)
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range words {
+				s.stopwords[w] = true
+			}
+		}
+		return s, nil
+	case splitSentence:
+		return &sentenceSegmenter{}, nil
+	case splitDelimiter:
+		if opts.Delimiter == "" {
+			return nil, errors.New("delimiter must be specified to split the input by it")
+		}
+		return &delimiterSegmenter{delimiter: opts.Delimiter}, nil
+	}
+	return nil, errors.Errorf("unknown split mode %s", opts.Split)
+}
+
+// readStopwords reads words from the file, one or more per line
+func readStopwords(fname string) ([]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read stopwords")
+	}
+	defer f.Close()
+
+	var words []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		for _, w := range strings.Fields(s.Text()) {
+			words = append(words, strings.ToLower(w))
+		}
+	}
+	return words, errors.Wrap(s.Err(), "can't read stopwords")
+}
+
+// lineSegmenter looks up each non empty line as the single request
+type lineSegmenter struct{}
+
+func (s *lineSegmenter) add(rec *record) []*segment {
+	if text := strings.TrimSpace(rec.text); text != "" {
+		return []*segment{{text: text, src: rec}}
+	}
+	return nil
+}
+
+func (s *lineSegmenter) flush() []*segment {
+	return nil
+}
+
+func (s *lineSegmenter) buffered() *record {
+	return nil
+}
+
+// wordSegmenter looks up words, skipping stopwords, which are compared ignoring case
+type wordSegmenter struct {
+	// stopwords are the built-in ones of the source language and the ones from the file
+	stopwords map[string]bool
+	// detect is set if the source language is detected, built-in stopwords of the line language are skipped then
+	detect bool
+}
+
+func (s *wordSegmenter) add(rec *record) []*segment {
+	context := strings.TrimSpace(rec.text)
+	words := wordRe.FindAllString(rec.text, -1)
+	var lineStopwords map[string]bool
+	if s.detect {
+		lang := rec.from
+		if lang == "" {
+			lang = guessStopwordsLang(words)
+		}
+		lineStopwords = stopwordSets[lang]
+	}
+
+	var segs []*segment
+	for _, w := range words {
+		if lw := strings.ToLower(w); s.stopwords[lw] || lineStopwords[lw] {
+			continue
+		}
+		segs = append(segs, &segment{text: w, src: rec, context: context})
+	}
+	return segs
+}
+
+func (s *wordSegmenter) flush() []*segment {
+	return nil
+}
+
+func (s *wordSegmenter) buffered() *record {
+	return nil
+}
+
+// guessStopwordsLang returns the language, which built-in list of stopwords contains most of the words,
+// or the empty string if no list contains any. Stopwords are the most common words,
+// so they tell the language of the line without the call to the provider
+func guessStopwordsLang(words []string) string {
+	var langs []string
+	for lang := range stopwordSets {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	best, bestHits := "", 0
+	for _, lang := range langs {
+		hits := 0
+		for _, w := range words {
+			if stopwordSets[lang][strings.ToLower(w)] {
+				hits++
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = lang, hits
+		}
+	}
+	return best
+}
+
+// sentenceSegmenter looks up each sentence, which can span several lines, empty lines end paragraphs
+type sentenceSegmenter struct {
+	buf string
+	src *record
+}
+
+func (s *sentenceSegmenter) add(rec *record) []*segment {
+	line := strings.TrimSpace(rec.text)
+	if line == "" {
+		return s.flush()
+	}
+	if s.buf == "" {
+		s.buf, s.src = line, rec
+	} else {
+		s.buf += " " + line
+	}
+
+	var segs []*segment
+	// the space is added to find the end of the sentence at the end of the line
+	text := s.buf + " "
+	for {
+		loc := sentenceEndRe.FindStringIndex(text)
+		if loc == nil {
+			break
+		}
+		segs = append(segs, &segment{text: strings.TrimSpace(text[:loc[1]]), src: s.src})
+		text = text[loc[1]:]
+		// the next sentence starts at the current record
+		s.src = rec
+	}
+	s.buf = strings.TrimSpace(text)
+	return segs
+}
+
+func (s *sentenceSegmenter) flush() []*segment {
+	if s.buf == "" {
+		return nil
+	}
+	seg := &segment{text: s.buf, src: s.src}
+	s.buf = ""
+	return []*segment{seg}
+}
+
+func (s *sentenceSegmenter) buffered() *record {
+	if s.buf == "" {
+		return nil
+	}
+	return s.src
+}
+
+// delimiterSegmenter looks up each part of lines separated by the delimiter
+type delimiterSegmenter struct {
+	delimiter string
+}
+
+func (s *delimiterSegmenter) add(rec *record) []*segment {
+	parts := strings.Split(rec.text, s.delimiter)
+	var context string
+	if len(parts) > 1 {
+		context = strings.TrimSpace(rec.text)
+	}
+
+	var segs []*segment
+	for _, p := range parts {
+		if text := strings.TrimSpace(p); text != "" {
+			segs = append(segs, &segment{text: text, src: rec, context: context})
+		}
+	}
+	return segs
+}
+
+func (s *delimiterSegmenter) flush() []*segment {
+	return nil
+}
+
+func (s *delimiterSegmenter) buffered() *record {
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// segmentTexts returns texts of segments produced by the segmenter from the lines
+func segmentTexts(s segmenter, lines ...string) []string {
+	var texts []string
+	for i, line := range lines {
+		for _, seg := range s.add(&record{text: line, line: i + 1}) {
+			texts = append(texts, seg.text)
+		}
+	}
+	for _, seg := range s.flush() {
+		texts = append(texts, seg.text)
+	}
+	return texts
+}
+
+func Test_newSegmenter(t *testing.T) {
+	s, err := newSegmenter(&options{})
+	require.NoError(t, err)
+	assert.IsType(t, &lineSegmenter{}, s)
+
+	s, err = newSegmenter(&options{Split: splitWord, FromLang: "en"})
+	require.NoError(t, err)
+	assert.True(t, s.(*wordSegmenter).stopwords["the"])
+	assert.False(t, s.(*wordSegmenter).detect)
+
+	// stopwords of the detected language are taken from the list of the language of the line
+	s, err = newSegmenter(&options{Split: splitWord, FromLang: "auto"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dog", "cat", "Hund", "Katze", "war", "die"},
+		segmentTexts(s, "the dog and the cat", "der Hund und die Katze", "the war and the die"))
+
+	s, err = newSegmenter(&options{Split: splitWord, FromLang: "en", KeepStopwords: true})
+	require.NoError(t, err)
+	assert.Empty(t, s.(*wordSegmenter).stopwords)
+
+	dir, err := ioutil.TempDir("", "lu")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "stopwords")
+	require.NoError(t, ioutil.WriteFile(fname, []byte("Dog cat\nfox\n"), 0644))
+	s, err = newSegmenter(&options{Split: splitWord, FromLang: "auto", StopwordsFile: fname})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"dog": true, "cat": true, "fox": true}, s.(*wordSegmenter).stopwords)
+
+	_, err = newSegmenter(&options{Split: splitWord, StopwordsFile: filepath.Join(dir, "none")})
+	assert.Error(t, err)
+
+	_, err = newSegmenter(&options{Split: splitDelimiter})
+	assert.EqualError(t, err, "delimiter must be specified to split the input by it")
+
+	_, err = newSegmenter(&options{Split: "paragraph"})
+	assert.EqualError(t, err, "unknown split mode paragraph")
+}
+
+func Test_lineSegmenter(t *testing.T) {
+	assert.Equal(t, []string{"dog", "black cat"}, segmentTexts(&lineSegmenter{}, " dog ", "", "black cat"))
+}
+
+func Test_wordSegmenter(t *testing.T) {
+	s := &wordSegmenter{stopwords: map[string]bool{"the": true, "a": true}}
+	rec := &record{text: "  The dog isn't a well-known dog, 42 Dogs. ", line: 3}
+	segs := s.add(rec)
+	require.Len(t, segs, 5)
+	assert.Equal(t, &segment{text: "dog", src: rec, context: "The dog isn't a well-known dog, 42 Dogs."}, segs[0])
+	assert.Equal(t, "isn't", segs[1].text)
+	assert.Equal(t, "well-known", segs[2].text)
+	assert.Equal(t, "dog", segs[3].text)
+	assert.Equal(t, "Dogs", segs[4].text)
+	assert.Equal(t, []string{"über", "Über"}, segmentTexts(s, "THE über Über"))
+
+	// the language set for the record is used instead of the guessed one
+	s = &wordSegmenter{stopwords: map[string]bool{}, detect: true}
+	segs = s.add(&record{text: "die war so", from: "en"})
+	require.Len(t, segs, 2)
+	assert.Equal(t, "die", segs[0].text)
+}
+
+func Test_guessStopwordsLang(t *testing.T) {
+	assert.Equal(t, "en", guessStopwordsLang([]string{"The", "dog", "and", "the", "cat"}))
+	assert.Equal(t, "de", guessStopwordsLang([]string{"der", "Hund", "und", "die", "Katze"}))
+	assert.Equal(t, "", guessStopwordsLang([]string{"dog", "cat"}))
+}
+
+func Test_sentenceSegmenter(t *testing.T) {
+	s := &sentenceSegmenter{}
+	first, second := &record{text: "The dog barks", line: 1}, &record{text: "loudly. The cat «sleeps!» Does it", line: 2}
+	assert.Nil(t, s.add(first))
+	segs := s.add(second)
+	require.Len(t, segs, 2)
+	assert.Equal(t, &segment{text: "The dog barks loudly.", src: first}, segs[0])
+	assert.Equal(t, &segment{text: "The cat «sleeps!»", src: second}, segs[1])
+
+	// empty lines end sentences
+	segs = s.add(&record{line: 3})
+	require.Len(t, segs, 1)
+	assert.Equal(t, &segment{text: "Does it", src: second}, segs[0])
+
+	assert.Equal(t, []string{"Yes.", "No", "3.5 dogs"}, segmentTexts(&sentenceSegmenter{}, "Yes. No", "", "3.5 dogs"))
+}
+
+func Test_delimiterSegmenter(t *testing.T) {
+	s := &delimiterSegmenter{delimiter: ";"}
+	rec := &record{text: "dog; black cat;;", line: 1}
+	segs := s.add(rec)
+	require.Len(t, segs, 2)
+	assert.Equal(t, &segment{text: "dog", src: rec, context: "dog; black cat;;"}, segs[0])
+	assert.Equal(t, &segment{text: "black cat", src: rec, context: "dog; black cat;;"}, segs[1])
+
+	// the context isn't needed if the line is the single request
+	rec = &record{text: " fox ", line: 2}
+	assert.Equal(t, []*segment{{text: "fox", src: rec}}, s.add(rec))
+	assert.Nil(t, s.flush())
+}
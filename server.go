@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// shutdownTimeout is the time given to running requests to finish when the server stops
+const shutdownTimeout = 10 * time.Second
+
+// maxBodySize is the maximum size of the batch lookup request body
+const maxBodySize = 1 << 20
+
+// serveCommand holds options of the serve command
+type serveCommand struct {
+	Addr     string `long:"addr" env:"LU_SERVE_ADDR" default:"localhost:8080" description:"address to listen on"`
+	MaxBatch int    `long:"max-batch" env:"LU_SERVE_MAX_BATCH" default:"100" description:"maximum number of requests in the batch lookup"`
+}
+
+// statusClientClosed is the status of requests stopped because the client went away, it is the one used by nginx.
+// The client doesn't get the response, but the status is logged
+const statusClientClosed = 499
+
+// server provides lookups over HTTP: JSON API and the search page
+type server struct {
+	lu       *Lu
+	maxBatch int
+	page     *template.Template
+	log      *log.Logger
+
+	// langs and dictDirs are languages and dictionary directions supported by the provider,
+	// they are fetched once and used to check languages of all requests, langsMu guards them
+	langsMu  sync.Mutex
+	langs    *lookup.Languages
+	dictDirs []string
+}
+
+// batchRequest is the body of the batch lookup request, languages are optional
+type batchRequest struct {
+	Requests []string `json:"requests"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// pageData is passed to the search page template
+type pageData struct {
+	Entries []*lookup.Entry
+	Query   string
+	From    string
+	To      string
+	Error   string
+	// Provider is the name of the provider, some of them require attribution
+	Provider string
+}
+
+// serve runs the HTTP server until the done channel is closed, then waits for running requests to finish
+func serve(opts options, done chan struct{}) error {
+	lu := &Lu{opts: opts}
+	if err := lu.setupAPI(); err != nil {
+		return err
+	}
+	if err := lookup.CheckTemplates(opts.TemplatesDir); err != nil {
+		return err
+	}
+
+	s, err := newServer(lu, opts.Serve.MaxBatch, log.New(os.Stderr, "", log.LstdFlags))
+	if err != nil {
+		return err
+	}
+	// supported languages are fetched before the first request, so e.g. the wrong API key is reported at once
+	if _, _, err = s.supportedLangs(context.Background()); err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: opts.Serve.Addr, Handler: s.handler()}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	s.log.Printf("listening on %s", opts.Serve.Addr)
+
+	select {
+	case err = <-errCh:
+		return errors.Wrap(err, "can't run server")
+	case <-done:
+	}
+
+	s.log.Printf("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return errors.Wrap(srv.Shutdown(ctx), "can't shut server down")
+}
+
+// newServer creates the server, parsing the search page template with templates of the user templates directory
+func newServer(lu *Lu, maxBatch int, logger *log.Logger) (*server, error) {
+	t := newHTMLTemplater(lu.opts.TemplatesDir)
+	page, err := lookup.ParseTemplate(t.Entry() + t.List() + t.Layout() + t.Search())
+	if err != nil {
+		return nil, err
+	}
+	return &server{lu: lu, maxBatch: maxBatch, page: page, log: logger}, nil
+}
+
+// handler returns the handler of all server routes, which logs requests
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handlePage)
+	mux.HandleFunc("/api/lookup", s.handleLookup)
+	mux.HandleFunc("/api/batch", s.handleBatch)
+	mux.HandleFunc("/api/languages", s.handleLanguages)
+	return s.logRequests(mux)
+}
+
+// statusRecorder keeps the status code of the response to log it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs the method, the URL, the status and the duration of each request
+func (s *server) logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		s.log.Printf("%s %s %s %d %s", r.RemoteAddr, r.Method, r.URL.RequestURI(), rec.status, time.Since(start))
+	})
+}
+
+// forLangs returns the copy of Lu looking requests up from and to languages, default ones are used if they are empty
+func (s *server) forLangs(ctx context.Context, from string, to []string) (*Lu, error) {
+	lu := &Lu{opts: s.lu.opts, client: s.lu.client}
+	if from != "" {
+		lu.opts.FromLang = from
+	}
+	if len(to) > 0 {
+		lu.opts.ToLangs = to
+	}
+	if len(lu.opts.ToLangs) == 0 {
+		return nil, errors.New("languages to translate to must be specified")
+	}
+	langs, dictDirs, err := s.supportedLangs(ctx)
+	if err != nil || langs == nil {
+		return lu, err
+	}
+	return lu, lu.validateLangs(ioutil.Discard, langs, dictDirs)
+}
+
+// supportedLangs returns languages and dictionary directions supported by the provider, they are fetched once.
+// Languages are nil if the provider can't list them. If they can't be fetched, the warning is logged
+// and they are fetched again for the next request
+func (s *server) supportedLangs(ctx context.Context) (*lookup.Languages, []string, error) {
+	s.langsMu.Lock()
+	defer s.langsMu.Unlock()
+	if s.langs != nil {
+		return s.langs, s.dictDirs, nil
+	}
+
+	var warnings bytes.Buffer
+	langs, dictDirs, err := s.lu.fetchLangs(ctx, &warnings)
+	if err != nil {
+		return nil, nil, err
+	}
+	if warnings.Len() > 0 {
+		s.log.Print(strings.TrimSpace(warnings.String()))
+		return langs, dictDirs, nil
+	}
+	s.langs, s.dictDirs = langs, dictDirs
+	return langs, dictDirs, nil
+}
+
+// queryLangs returns languages to translate to from the query, they can be repeated or comma separated
+func queryLangs(values []string) []string {
+	var langs []string
+	for _, v := range values {
+		for _, lang := range strings.Split(v, ",") {
+			if lang = strings.TrimSpace(lang); lang != "" {
+				langs = append(langs, lang)
+			}
+		}
+	}
+	return langs
+}
+
+// handleLookup looks up the single request, e.g. GET /api/lookup?q=dog&from=en&to=de,it
+func (s *server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET method is allowed"))
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, errors.New("request to look up must be specified as q parameter"))
+		return
+	}
+
+	e, err := s.lookup(r.Context(), q, r.URL.Query().Get("from"), queryLangs(r.URL.Query()["to"]))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// handleBatch looks up requests of the JSON body, e.g. {"requests": ["dog", "cat"], "to": ["de"]},
+// and returns the array of results in the same order
+func (s *server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only POST method is allowed"))
+		return
+	}
+	var req batchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "can't parse request body"))
+		return
+	}
+	if len(req.Requests) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("requests to look up must be specified"))
+		return
+	}
+	if s.maxBatch > 0 && len(req.Requests) > s.maxBatch {
+		writeError(w, http.StatusBadRequest, errors.Errorf("too many requests, the maximum is %d", s.maxBatch))
+		return
+	}
+
+	lu, err := s.forLangs(r.Context(), req.From, req.To)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	texts := make([]string, len(req.Requests))
+	for i, text := range req.Requests {
+		texts[i] = strings.TrimSpace(text)
+	}
+	entries, err := lu.client.LookupBatch(r.Context(), texts, lu.opts.FromLang, lu.opts.ToLangs)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleLanguages lists supported languages and directions, e.g. GET /api/languages?from=en&ui=ru
+func (s *server) handleLanguages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET method is allowed"))
+		return
+	}
+	q := r.URL.Query()
+	ui := q.Get("ui")
+	if ui == "" {
+		ui = s.lu.opts.LangsUI
+	}
+	filter := langsFilter{from: q.Get("from"), to: q.Get("to")}
+
+	var b bytes.Buffer
+	if err := showLangs(r.Context(), &b, s.lu, ui, filter, true); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	b.WriteTo(w)
+}
+
+// handlePage renders the search page with results of the request from the query
+func (s *server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	data := &pageData{
+		Query:    strings.TrimSpace(q.Get("q")),
+		From:     q.Get("from"),
+		To:       strings.Join(queryLangs(q["to"]), ","),
+		Provider: s.lu.client.Provider(),
+	}
+	if data.From == "" {
+		data.From = s.lu.opts.FromLang
+	}
+	if data.To == "" {
+		data.To = strings.Join(s.lu.opts.ToLangs, ",")
+	}
+
+	status := http.StatusOK
+	if data.Query != "" {
+		e, err := s.lookup(r.Context(), data.Query, data.From, queryLangs([]string{data.To}))
+		if err != nil {
+			status, data.Error = errorStatus(err), err.Error()
+		} else {
+			data.Entries = []*lookup.Entry{e}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := s.page.Execute(&b, data); err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "can't render template"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	b.WriteTo(w)
+}
+
+// lookup looks the request up from and to languages, it is stopped when the client goes away
+func (s *server) lookup(ctx context.Context, req, from string, to []string) (*lookup.Entry, error) {
+	lu, err := s.forLangs(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return lu.lookupEntry(ctx, req)
+}
+
+// errorStatus returns the HTTP status for the error: errors of providers are reported as gateway ones,
+// lookups stopped because the client went away have the status of their own, other errors are caused by wrong requests
+func errorStatus(err error) int {
+	if errors.Cause(err) == context.Canceled {
+		return statusClientClosed
+	}
+	switch lookup.KindOf(err) {
+	case lookup.ErrTransient:
+		return http.StatusServiceUnavailable
+	case lookup.ErrFatal:
+		return http.StatusBadGateway
+	}
+	return http.StatusBadRequest
+}
+
+// writeJSON writes the value as JSON with the status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the error as JSON object with the status, e.g. {"error": "unknown language xx"}
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
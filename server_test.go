@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dafanasev/lu/internal/mock"
+	"github.com/dafanasev/lu/lookup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer creates the server using mock APIs, requests are logged to the buffer
+func newTestServer(t *testing.T) (*server, *bytes.Buffer) {
+	lu := &Lu{opts: options{FromLang: "en", ToLangs: []string{"de"}, LangsUI: "en", Jobs: 2}}
+	lu.client = newMockClient(t, lookup.Options{Jobs: lu.opts.Jobs})
+	var logs bytes.Buffer
+	s, err := newServer(lu, 2, log.New(&logs, "", 0))
+	require.NoError(t, err)
+	return s, &logs
+}
+
+// doRequest makes the request to the server handler and returns the response
+func doRequest(s *server, method, url, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+	return w
+}
+
+func Test_server_handleLookup(t *testing.T) {
+	s, logs := newTestServer(t)
+
+	w := doRequest(s, "GET", "/api/lookup?q=dog", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var e lookup.Entry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.Equal(t, "dog", e.Request)
+	require.Len(t, e.Responses, 1)
+	assert.Equal(t, []string{"Hund", "Rüde", "geiler Bock"}, e.Responses[0].Translations)
+	assert.Contains(t, logs.String(), "GET /api/lookup?q=dog 200")
+
+	// languages of the query override the default ones
+	w = doRequest(s, "GET", "/api/lookup?q=Hund&from=de&to=en,it", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.Equal(t, "de", e.From)
+	assert.Len(t, e.Responses, 2)
+
+	w = doRequest(s, "GET", "/api/lookup?q=dog&to=xx", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"unknown language xx"}`+"\n", w.Body.String())
+
+	w = doRequest(s, "GET", "/api/lookup", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(s, "POST", "/api/lookup?q=dog", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	// the server which hasn't fetched supported languages yet
+	s, _ = newTestServer(t)
+	tr := &failingTranslator{err: &lookup.APIError{Kind: lookup.ErrFatal, Err: errors.New("(401) API key is invalid")}}
+	s.lu.client = newTestClient(t, mock.New().Dictionary, tr, lookup.Options{})
+	s.lu.opts.MTOnly = true
+	w = doRequest(s, "GET", "/api/lookup?q=dog", "")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "API key is invalid")
+}
+
+// countingTranslator counts calls listing languages supported by the translator
+type countingTranslator struct {
+	lookup.Translator
+	langs int
+}
+
+func (t *countingTranslator) GetLangs(ctx context.Context, ui string) (*lookup.Languages, error) {
+	t.langs++
+	return t.Translator.GetLangs(ctx, ui)
+}
+
+func Test_server_supportedLangs(t *testing.T) {
+	s, _ := newTestServer(t)
+	p := mock.New()
+	tr := &countingTranslator{Translator: p.Translator}
+	s.lu.client = newTestClient(t, p.Dictionary, tr, lookup.Options{})
+
+	// languages of requests are checked against ones fetched for the first request
+	for _, url := range []string{"/api/lookup?q=dog", "/api/lookup?q=dog&to=it", "/api/lookup?q=dog&to=xx"} {
+		doRequest(s, "GET", url, "")
+	}
+	w := doRequest(s, "GET", "/api/lookup?q=dog&to=xx", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 1, tr.langs)
+
+	// languages are fetched again if they couldn't be fetched
+	s, logs := newTestServer(t)
+	fail := &failingTranslator{err: &lookup.APIError{Kind: lookup.ErrTransient, Err: errors.New("(503) unavailable")}}
+	s.lu.client = newTestClient(t, p.Dictionary, fail, lookup.Options{})
+	langs, _, err := s.supportedLangs(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, langs)
+	assert.Contains(t, logs.String(), "warning: can't check languages, (503) unavailable")
+	s.lu.client = newMockClient(t, lookup.Options{})
+	langs, _, err = s.supportedLangs(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, langs.Names, 3)
+}
+
+func Test_errorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, errorStatus(errors.New("unknown language xx")))
+	assert.Equal(t, http.StatusServiceUnavailable, errorStatus(&lookup.APIError{Kind: lookup.ErrTransient, Err: errors.New("timeout")}))
+	assert.Equal(t, http.StatusBadGateway, errorStatus(&lookup.APIError{Kind: lookup.ErrFatal, Err: errors.New("(401) API key is invalid")}))
+	// the client went away
+	assert.Equal(t, statusClientClosed, errorStatus(context.Canceled))
+	assert.Equal(t, statusClientClosed, errorStatus(&lookup.APIError{Kind: lookup.ErrTransient, Err: context.Canceled}))
+}
+
+func Test_server_handleBatch(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	w := doRequest(s, "POST", "/api/batch", `{"requests": ["dog", "black dog"], "to": ["de"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var entries []*lookup.Entry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, "dog", entries[0].Request)
+	assert.Equal(t, []string{"schwarzer Hund"}, entries[1].Responses[0].Translations)
+
+	w = doRequest(s, "POST", "/api/batch", `{"requests": ["dog", "cat", "fox"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "too many requests, the maximum is 2")
+
+	w = doRequest(s, "POST", "/api/batch", `{"requests": []}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(s, "POST", "/api/batch", `["dog"]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "can't parse request body")
+
+	w = doRequest(s, "GET", "/api/batch", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func Test_server_handleLanguages(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	w := doRequest(s, "GET", "/api/languages", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list langsList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Languages, 3)
+
+	w = doRequest(s, "GET", "/api/languages?from=en", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Directions, 2)
+	assert.Equal(t, "de", list.Directions[0].To)
+}
+
+func Test_server_handlePage(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	w := doRequest(s, "GET", "/", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<form id="search"`)
+	assert.Contains(t, w.Body.String(), `name="to" value="de"`)
+	assert.NotContains(t, w.Body.String(), "<dt")
+
+	w = doRequest(s, "GET", "/?q=dog&to=de,it", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `name="to" value="de,it"`)
+	assert.Contains(t, w.Body.String(), "<dt id=1>dog</dt>")
+	assert.Contains(t, w.Body.String(), "Hund")
+
+	w = doRequest(s, "GET", "/?q=dog&to=xx", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `<p class="error">unknown language xx</p>`)
+
+	w = doRequest(s, "GET", "/favicon.ico", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_serve(t *testing.T) {
+	os.Setenv("LU_TEST", "1")
+	defer os.Unsetenv("LU_TEST")
+
+	done := make(chan struct{})
+	close(done)
+	// the server stops at once
+	err := serve(options{FromLang: "en", Serve: serveCommand{Addr: "localhost:0"}, NoCache: true}, done)
+	assert.NoError(t, err)
+
+	err = serve(options{FromLang: "en", Serve: serveCommand{Addr: "localhost:-1"}, NoCache: true}, make(chan struct{}))
+	assert.Error(t, err)
+}
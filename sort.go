@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// keys results can be sorted by
+const (
+	sortRequest     = "request"
+	sortTranslation = "translation"
+	sortFrom        = "from"
+	sortCount       = "count"
+	sortLine        = "line"
+)
+
+// sortKey is the key results are sorted by, in the ascending or the descending order
+type sortKey struct {
+	name string
+	desc bool
+}
+
+// parseSortKeys parses comma separated sort keys, prefixed with - for the descending order, e.g. -count,request.
+// Values true and false of the config file mean sorting by requests and no sorting
+func parseSortKeys(spec string) ([]sortKey, error) {
+	switch spec {
+	case "", "false":
+		return nil, nil
+	case "true":
+		return []sortKey{{name: sortRequest}}, nil
+	}
+
+	var keys []sortKey
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		key := sortKey{name: strings.TrimPrefix(s, "-"), desc: strings.HasPrefix(s, "-")}
+		switch key.name {
+		case sortRequest, sortTranslation, sortFrom, sortCount, sortLine:
+		default:
+			return nil, errors.Errorf("unknown sort key %s, use request, translation, from, count or line", s)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// entriesSorter sorts results by keys, requests and translations are compared according to rules of their languages.
+// Ties are resolved by requests and then by the input order
+type entriesSorter struct {
+	keys []sortKey
+	// reqColl and trColl compare requests and translations
+	reqColl *collate.Collator
+	trColl  *collate.Collator
+}
+
+// newEntriesSorter creates the sorter, from and to are languages of requests and translations,
+// root collation rules are used if the language isn't known
+func newEntriesSorter(keys []sortKey, from string, to []string) *entriesSorter {
+	var trLang string
+	if len(to) > 0 {
+		trLang = to[0]
+	}
+	return &entriesSorter{keys: keys, reqColl: newCollator(from), trColl: newCollator(trLang)}
+}
+
+// newCollator creates the collator for the language
+func newCollator(lang string) *collate.Collator {
+	tag := language.Und
+	if lang != "" && lang != lookup.AutoLang {
+		tag = language.Make(lang)
+	}
+	return collate.New(tag)
+}
+
+// sort sorts entries, keeping the input order of equal ones
+func (s *entriesSorter) sort(entries []*lookup.Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return s.compare(entries[i], entries[j]) < 0
+	})
+}
+
+// compare returns -1, 0 or 1 if a goes before, along with or after b
+func (s *entriesSorter) compare(a, b *lookup.Entry) int {
+	for _, key := range s.keys {
+		c := s.compareBy(key.name, a, b)
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	if c := s.compareBy(sortRequest, a, b); c != 0 {
+		return c
+	}
+	return s.compareBy(sortLine, a, b)
+}
+
+// compareBy compares entries by the single key
+func (s *entriesSorter) compareBy(key string, a, b *lookup.Entry) int {
+	switch key {
+	case sortRequest:
+		return s.reqColl.CompareString(a.Request, b.Request)
+	case sortTranslation:
+		// results without translations go after the ones having them
+		ta, tb := firstTranslation(a), firstTranslation(b)
+		if (ta == "") != (tb == "") {
+			return compareBools(ta == "", tb == "")
+		}
+		return s.trColl.CompareString(ta, tb)
+	case sortFrom:
+		// all requests are translated to the same languages, but their source languages can differ,
+		// if they are detected or set in the data source
+		return strings.Compare(a.From, b.From)
+	case sortCount:
+		return compareInts(occurrenceCount(a), occurrenceCount(b))
+	case sortLine:
+		return compareInts(a.Line, b.Line)
+	}
+	return 0
+}
+
+// firstTranslation returns the first translation of the entry, or the empty string if there is no one
+func firstTranslation(e *lookup.Entry) string {
+	for _, resp := range e.Responses {
+		if len(resp.Translations) > 0 {
+			return resp.Translations[0]
+		}
+	}
+	return ""
+}
+
+// occurrenceCount returns the number of occurrences of the entry request, which is 1 if they aren't counted
+func occurrenceCount(e *lookup.Entry) int {
+	if e.Count == 0 {
+		return 1
+	}
+	return e.Count
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareBools compares booleans, false goes before true
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requests returns requests of entries
+func requests(entries []*lookup.Entry) []string {
+	var reqs []string
+	for _, e := range entries {
+		reqs = append(reqs, e.Request)
+	}
+	return reqs
+}
+
+func Test_parseSortKeys(t *testing.T) {
+	keys, err := parseSortKeys("-count, request")
+	require.NoError(t, err)
+	assert.Equal(t, []sortKey{{name: "count", desc: true}, {name: "request"}}, keys)
+
+	keys, err = parseSortKeys("true")
+	require.NoError(t, err)
+	assert.Equal(t, []sortKey{{name: "request"}}, keys)
+
+	for _, spec := range []string{"", "false"} {
+		keys, err = parseSortKeys(spec)
+		require.NoError(t, err)
+		assert.Nil(t, keys)
+	}
+
+	_, err = parseSortKeys("request,size")
+	assert.EqualError(t, err, "unknown sort key size, use request, translation, from, count or line")
+}
+
+func Test_entriesSorter_collation(t *testing.T) {
+	entries := []*lookup.Entry{{Request: "Birne"}, {Request: "Äpfel"}, {Request: "apfel"}, {Request: "Zucker"}}
+	newEntriesSorter([]sortKey{{name: sortRequest}}, "de", nil).sort(entries)
+	assert.Equal(t, []string{"apfel", "Äpfel", "Birne", "Zucker"}, requests(entries))
+
+	// ё goes after я in the byte order
+	entries = []*lookup.Entry{{Request: "яблоко"}, {Request: "ёж"}, {Request: "еда"}}
+	newEntriesSorter([]sortKey{{name: sortRequest}}, "ru", nil).sort(entries)
+	assert.Equal(t, []string{"еда", "ёж", "яблоко"}, requests(entries))
+
+	// the language isn't known if it is detected, root rules are used
+	entries = []*lookup.Entry{{Request: "élan"}, {Request: "zèbre"}, {Request: "eau"}}
+	newEntriesSorter([]sortKey{{name: sortRequest}}, "auto", nil).sort(entries)
+	assert.Equal(t, []string{"eau", "élan", "zèbre"}, requests(entries))
+}
+
+func Test_entriesSorter_keys(t *testing.T) {
+	entries := []*lookup.Entry{
+		{Request: "cat", Line: 1, Count: 2, From: "en", Responses: []*lookup.Response{{Lang: "it", Translations: []string{"gatto"}}}},
+		{Request: "dog", Line: 2, Count: 3, From: "en", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Hund"}}}},
+		{Request: "bird", Line: 3, From: "de", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Vogel"}}}},
+		{Request: "ant", Line: 4, Count: 2, From: "it", Responses: []*lookup.Response{{Lang: "de"}}},
+	}
+	sortBy := func(spec string) []string {
+		keys, err := parseSortKeys(spec)
+		require.NoError(t, err)
+		newEntriesSorter(keys, "en", []string{"de"}).sort(entries)
+		return requests(entries)
+	}
+
+	// results without translations go last
+	assert.Equal(t, []string{"cat", "dog", "bird", "ant"}, sortBy("translation"))
+	assert.Equal(t, []string{"ant", "bird", "dog", "cat"}, sortBy("-line"))
+	assert.Equal(t, []string{"ant", "bird", "cat", "dog"}, sortBy("request"))
+	assert.Equal(t, []string{"dog", "cat", "bird", "ant"}, sortBy("-request"))
+	// ties are resolved by requests
+	assert.Equal(t, []string{"dog", "ant", "cat", "bird"}, sortBy("-count"))
+	// source languages differ, when they are detected or set in the data source
+	assert.Equal(t, []string{"bird", "cat", "dog", "ant"}, sortBy("from"))
+	assert.Equal(t, []string{"ant", "dog", "cat", "bird"}, sortBy("-from,-count"))
+}
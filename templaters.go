@@ -1,75 +1,77 @@
 package main
 
 import (
-	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 
-	"github.com/gobuffalo/packr"
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
 )
 
-// box used to embed templates into executable binary
-var box = packr.NewBox("templates")
-
-// templatesFnMap holds functions use in templates
-var templatesFnMap = template.FuncMap{
-	"inc": func(i int) int {
-		return i + 1
-	},
-	// dict used to pass multiple values (in a map) to partial template
-	"dict": func(values ...interface{}) map[string]interface{} {
-		d := make(map[string]interface{}, len(values)/2)
-		for i := 0; i < len(values); i += 2 {
-			d[values[i].(string)] = values[i+1]
-		}
-		return d
-	},
+// defaultTemplatesDir returns the directory with user templates, if it isn't specified explicitly
+func defaultTemplatesDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "lu", "templates")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "lu", "templates")
 }
 
-// templater methods return templates (as strings) used to render lookup results
-type templater interface {
-	entry() string
-	list() string
+// stdoutTemplater is the templater
+// that defines the stdout method used to render results to stdout one by one
+type stdoutTemplater interface {
+	stdout() string
 }
 
-// layoutTemplater is the optional interface
-// that defines the layout method used to render output file layout
-type layoutTemplater interface {
-	layout() string
+// textTemplater implements lookup.Templater and stdoutTemplater interfaces
+// to print lookup results to stdout and render text files
+type textTemplater struct {
+	lookup.TextTemplater
 }
 
-// stdoutTemplater is the optional interface
-// that defines the stodut method used to render result to stdout
-type stdoutTemplater interface {
-	stdout() string
+// newTextTemplater returns the text templater using templates of the user templates directory,
+// which override the embedded ones with the same names
+func newTextTemplater(dir string) *textTemplater {
+	return &textTemplater{lookup.TextTemplater{Dir: dir}}
 }
 
-// textTemplater implements templater interface to print lookup results to stdout and render text files
-type textTemplater struct{}
-
-// list returns list text template from the box, which, in turn loads it from the FS
-// and embeds in the executable binary
-func (t *textTemplater) list() string {
-	return box.String("list.text.tmpl")
+func (t *textTemplater) stdout() string {
+	return t.Entry() + "{{ template \"entry\" . }}\n"
 }
 
-func (t *textTemplater) entry() string {
-	return box.String("entry.text.tmpl")
+// newHTMLTemplater returns the html templater using templates of the user templates directory
+func newHTMLTemplater(dir string) *lookup.HTMLTemplater {
+	return &lookup.HTMLTemplater{Dir: dir}
 }
 
-func (t *textTemplater) stdout() string {
-	return t.entry() + "{{ template \"entry\" . }}\n"
+// customTemplater implements lookup.Templater and stdoutTemplater interfaces using user supplied template file.
+// The file is the main template, entry template of the base templater can be used in it,
+// e.g. {{ template "entry" . }}
+type customTemplater struct {
+	text string
+	base lookup.Templater
 }
 
-// htmlTemplater implements templater and layoutTemplater interfaces to render lookup results to html files
-type htmlTemplater struct{}
+// newCustomTemplater reads and checks the template file
+func newCustomTemplater(fname string, base lookup.Templater) (*customTemplater, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read template")
+	}
+	if err = lookup.CheckTemplate(filepath.Base(fname), string(b)); err != nil {
+		return nil, err
+	}
+	return &customTemplater{text: string(b), base: base}, nil
+}
 
-func (t *htmlTemplater) layout() string {
-	return box.String("layout.html.tmpl")
+func (t *customTemplater) List() string {
+	return t.text
 }
 
-func (t *htmlTemplater) list() string {
-	return box.String("list.html.tmpl")
+func (t *customTemplater) Entry() string {
+	return t.base.Entry()
 }
 
-func (t *htmlTemplater) entry() string {
-	return box.String("entry.html.tmpl")
+func (t *customTemplater) stdout() string {
+	return t.base.Entry() + t.text
 }
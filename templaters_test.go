@@ -1,42 +1,66 @@
 package main
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/dafanasev/lu/lookup"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func Test_textTemplater_list(t *testing.T) {
-	assert.Contains(t, (&textTemplater{}).list(), "{{ range .Entries -}}")
+func withTemplatesDir(t *testing.T, files map[string]string, fn func(dir string)) {
+	dir, err := ioutil.TempDir("", "lu-templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for name, text := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0600))
+	}
+	fn(dir)
 }
 
-func Test_textTemplater_entry(t *testing.T) {
-	assert.Contains(t, (&textTemplater{}).entry(), "{{ range $idx, $tr := .Translations -}}")
+func Test_textTemplater_stdout(t *testing.T) {
+	withTemplatesDir(t, map[string]string{"entry.text.tmpl": `{{ define "entry" }}{{ .Request }}{{ end }}`}, func(dir string) {
+		tmpl, err := lookup.ParseTemplate(newTextTemplater(dir).stdout())
+		require.NoError(t, err)
+		var b bytes.Buffer
+		require.NoError(t, tmpl.Execute(&b, &lookup.Entry{Request: "dog"}))
+		assert.Equal(t, "dog\n", b.String())
+	})
 }
 
-func Test_htmlTemplater_layout(t *testing.T) {
-	assert.Contains(t, (&htmlTemplater{}).layout(), "<meta charset=\"utf-8\">")
-}
+func Test_customTemplater(t *testing.T) {
+	withTemplatesDir(t, map[string]string{
+		"custom.tmpl": "{{ range .Entries }}{{ .Request }}: {{ range .Responses }}{{ .Translations | join \", \" }}{{ end }}\n{{ end }}",
+		"stdout.tmpl": "{{ template \"entry\" . }}|{{ .Request | upper }}",
+		"broken.tmpl": "\n{{ .Request",
+	}, func(dir string) {
+		_, err := newCustomTemplater(filepath.Join(dir, "not_existed.tmpl"), &textTemplater{})
+		assert.Error(t, err)
 
-func Test_htmlTemplater_list(t *testing.T) {
-	assert.Contains(t, (&htmlTemplater{}).list(), "<ol id=\"req-list\">")
-}
+		_, err = newCustomTemplater(filepath.Join(dir, "broken.tmpl"), &textTemplater{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "broken.tmpl:2")
 
-func Test_htmlTemplater_entry(t *testing.T) {
-	assert.Contains(t, (&htmlTemplater{}).entry(), "<header>{{ .Lang }}</header>")
-}
-
-func Test_templatesFnMap_inc(t *testing.T) {
-	incFn := templatesFnMap["inc"].(func(int) int)
-	assert.Equal(t, incFn(2), 3)
-}
+		ct, err := newCustomTemplater(filepath.Join(dir, "custom.tmpl"), &lookup.HTMLTemplater{})
+		require.NoError(t, err)
+		assert.Equal(t, (&lookup.HTMLTemplater{}).Entry(), ct.Entry())
 
-func Test_templatesFnMap_dict(t *testing.T) {
-	dictFn := templatesFnMap["dict"].(func(values ...interface{}) map[string]interface{})
-	args := []interface{}{"one", 1, "two", "2", "three", "drei"}
-	expected := map[string]interface{}{"one": 1, "two": "2", "three": "drei"}
-	assert.Equal(t, expected, dictFn(args...))
+		var b bytes.Buffer
+		entries := []*lookup.Entry{{Request: "dog", Responses: []*lookup.Response{{Lang: "de", Translations: []string{"Hund", "Rüde"}}}}}
+		require.NoError(t, (&lookup.TemplateRenderer{Templater: ct}).Render(&b, entries))
+		assert.Equal(t, "dog: Hund, Rüde\n", b.String())
 
-	args = append(args, "odd")
-	assert.Panics(t, func() { dictFn(args...) })
+		ct, err = newCustomTemplater(filepath.Join(dir, "stdout.tmpl"), &textTemplater{})
+		require.NoError(t, err)
+		tmpl, err := lookup.ParseTemplate(ct.stdout())
+		require.NoError(t, err)
+		b.Reset()
+		require.NoError(t, tmpl.Execute(&b, entries[0]))
+		assert.Contains(t, b.String(), "1. Hund")
+		assert.Contains(t, b.String(), "|DOG")
+	})
 }
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package main
+
+import "github.com/pkg/errors"
+
+// isTerminal always returns false, so the interactive mode is not used on this platform
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (func() error, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal reports whether the file descriptor is the terminal
+func isTerminal(fd uintptr) bool {
+	var t syscall.Termios
+	return ioctlTermios(fd, ioctlGetTermios, &t) == nil
+}
+
+// makeRaw puts the terminal into the raw mode, so input is available byte by byte without echo,
+// and returns the function to restore the previous mode
+func makeRaw(fd uintptr) (func() error, error) {
+	var old syscall.Termios
+	if err := ioctlTermios(fd, ioctlGetTermios, &old); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+
+	return func() error { return ioctlTermios(fd, ioctlSetTermios, &old) }, nil
+}
+
+func ioctlTermios(fd uintptr, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/pkg/errors"
+)
+
+// vocabularyLockSuffix is added to the vocabulary file name to get the name of the lock file,
+// which is held while the vocabulary is updated, so concurrent runs don't lose each other's requests
+const vocabularyLockSuffix = ".lock"
+
+// vocabularyLockWait is the time to wait for the lock held by other run,
+// the lock older than vocabularyLockStale is left by the crashed run and is removed
+const (
+	vocabularyLockWait  = 10 * time.Second
+	vocabularyLockStale = time.Minute
+)
+
+// historyCommand holds the history subcommands, which work with the vocabulary of looked up requests
+type historyCommand struct {
+	List struct {
+		historyFilterOptions
+	} `command:"list" description:"list looked up requests, the latest first"`
+	Search struct {
+		historyFilterOptions
+		Args struct {
+			Query string `positional-arg-name:"QUERY"`
+		} `positional-args:"yes" required:"yes"`
+	} `command:"search" description:"list looked up requests which or translations of which contain the query"`
+	Delete struct {
+		historyFilterOptions
+		All  bool `long:"all" description:"delete all requests matching filters"`
+		Args struct {
+			Requests []string `positional-arg-name:"REQUEST"`
+		} `positional-args:"yes"`
+	} `command:"delete" description:"delete requests from the vocabulary"`
+	Export struct {
+		historyFilterOptions
+	} `command:"export" description:"write looked up requests to the destination file (-o flag) or stdout, in the output format (-F flag)"`
+}
+
+// historyFilterOptions holds options of history subcommands selecting requests
+type historyFilterOptions struct {
+	Lang  string `long:"lang" description:"select requests translated from or to the language"`
+	Since string `long:"since" description:"select requests looked up since the date, e.g. 2006-01-02, or the period ago, e.g. 7d or 12h"`
+	Until string `long:"until" description:"select requests looked up before the end of the date or the period ago"`
+}
+
+// vocabulary is the database of looked up requests, kept in the JSON file,
+// which remembers requests along with their latest results between runs
+type vocabulary struct {
+	Entries []*vocabularyEntry `json:"entries"`
+
+	file string
+	// index holds entries by their keys, see vocabularyKey, it is built on the first use
+	index map[string]*vocabularyEntry
+}
+
+// vocabularyEntry holds the request and its latest results for each language looked up
+type vocabularyEntry struct {
+	*lookup.Entry
+	// Lookups is the number of runs the request was looked up in
+	Lookups int       `json:"lookups"`
+	Added   time.Time `json:"added"`
+	Updated time.Time `json:"updated"`
+}
+
+// vocabularyFilter selects vocabulary entries, empty fields match any entry
+type vocabularyFilter struct {
+	// query is the part of requests or translations
+	query string
+	// requests are the requests to select, compared in the normalized form
+	requests []string
+	// lang is the language requests are translated from or to
+	lang string
+	// since and until limit the time of the last lookup
+	since time.Time
+	until time.Time
+}
+
+// defaultVocabularyFile returns the file to keep the vocabulary in, if it isn't specified explicitly
+func defaultVocabularyFile() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "lu", "vocabulary.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "share", "lu", "vocabulary.json")
+}
+
+// loadVocabulary reads the vocabulary file, the vocabulary is empty if there is no file yet
+func loadVocabulary(fname string) (*vocabulary, error) {
+	v := &vocabulary{file: fname}
+	data, err := ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read vocabulary")
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return nil, errors.Wrapf(err, "vocabulary file %s is broken", fname)
+	}
+	return v, nil
+}
+
+// updateVocabulary reads the vocabulary file, changes it with fn and saves it if fn reports it is changed.
+// The vocabulary is locked meanwhile, so it is read after changes of other runs are saved
+func updateVocabulary(fname string, fn func(v *vocabulary) bool) error {
+	unlock, err := lockVocabulary(fname)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	v, err := loadVocabulary(fname)
+	if err != nil {
+		return err
+	}
+	if !fn(v) {
+		return nil
+	}
+	return v.save()
+}
+
+// lockVocabulary creates the lock file of the vocabulary, waiting while other run holds it,
+// and returns the function removing it
+func lockVocabulary(fname string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return nil, errors.Wrap(err, "can't lock vocabulary")
+	}
+	lock := fname + vocabularyLockSuffix
+	deadline := time.Now().Add(vocabularyLockWait)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrap(err, "can't lock vocabulary")
+		}
+		if fi, err := os.Stat(lock); err == nil && time.Since(fi.ModTime()) > vocabularyLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("vocabulary is locked by other run of lu, remove %s if lu isn't running", lock)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// save writes the vocabulary file, creating its directory if it doesn't exist
+func (v *vocabulary) save() error {
+	if err := os.MkdirAll(filepath.Dir(v.file), 0700); err != nil {
+		return errors.Wrap(err, "can't save vocabulary")
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(writeFileAtomic(v.file, data), "can't save vocabulary")
+}
+
+// vocabularyKey returns the key of the request, requests with different languages are different ones
+func vocabularyKey(req, from string) string {
+	return from + "\x00" + normalizeRequest(req)
+}
+
+// add records the entry looked up at the time. Results of the request looked up before are replaced
+// by the new ones for the same languages and kept for other ones
+func (v *vocabulary) add(e *lookup.Entry, t time.Time) {
+	if len(e.Responses) == 0 {
+		return
+	}
+
+	key := vocabularyKey(e.Request, e.From)
+	if ve := v.lookup(key); ve != nil {
+		for _, resp := range e.Responses {
+			ve.setResponse(resp)
+		}
+		if e.Context != "" {
+			ve.Context = e.Context
+		}
+		if len(e.Meta) > 0 {
+			ve.Meta = e.Meta
+		}
+		ve.Lookups++
+		ve.Updated = t
+		return
+	}
+
+	// numbers of lines and counts of occurrences make sense only for the data source
+	stored := *e
+	stored.Line, stored.LastLine, stored.Count = 0, 0, 0
+	stored.Responses = append([]*lookup.Response{}, e.Responses...)
+	ve := &vocabularyEntry{Entry: &stored, Lookups: 1, Added: t, Updated: t}
+	v.Entries = append(v.Entries, ve)
+	v.index[key] = ve
+}
+
+// lookup returns the entry with the key or nil, building the index of entries if it isn't built yet
+func (v *vocabulary) lookup(key string) *vocabularyEntry {
+	if v.index == nil {
+		v.index = make(map[string]*vocabularyEntry, len(v.Entries))
+		for _, ve := range v.Entries {
+			k := vocabularyKey(ve.Request, ve.From)
+			if _, ok := v.index[k]; !ok {
+				v.index[k] = ve
+			}
+		}
+	}
+	return v.index[key]
+}
+
+// setResponse replaces the response for the same language or adds the new one
+func (ve *vocabularyEntry) setResponse(resp *lookup.Response) {
+	for i, r := range ve.Responses {
+		if r.Lang == resp.Lang {
+			ve.Responses[i] = resp
+			return
+		}
+	}
+	ve.Responses = append(ve.Responses, resp)
+}
+
+// find returns entries selected by the filter, the latest looked up first
+func (v *vocabulary) find(f *vocabularyFilter) []*vocabularyEntry {
+	var found []*vocabularyEntry
+	for _, ve := range v.Entries {
+		if f.match(ve) {
+			found = append(found, ve)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Updated.After(found[j].Updated) })
+	return found
+}
+
+// remove deletes entries selected by the filter and returns their number
+func (v *vocabulary) remove(f *vocabularyFilter) int {
+	var kept []*vocabularyEntry
+	for _, ve := range v.Entries {
+		if !f.match(ve) {
+			kept = append(kept, ve)
+		}
+	}
+	n := len(v.Entries) - len(kept)
+	v.Entries = kept
+	// the index is built again with the rest of entries
+	v.index = nil
+	return n
+}
+
+// match reports whether the entry is selected by the filter
+func (f *vocabularyFilter) match(ve *vocabularyEntry) bool {
+	if !f.since.IsZero() && ve.Updated.Before(f.since) || !f.until.IsZero() && !ve.Updated.Before(f.until) {
+		return false
+	}
+	if f.lang != "" && ve.From != f.lang && !ve.hasLang(f.lang) {
+		return false
+	}
+	if len(f.requests) > 0 {
+		req := normalizeRequest(ve.Request)
+		found := false
+		for _, r := range f.requests {
+			if normalizeRequest(r) == req {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.query != "" {
+		q := normalizeRequest(f.query)
+		if strings.Contains(normalizeRequest(ve.Request), q) {
+			return true
+		}
+		for _, resp := range ve.Responses {
+			for _, tr := range resp.Translations {
+				if strings.Contains(normalizeRequest(tr), q) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// hasLang reports whether the request was translated to the language
+func (ve *vocabularyEntry) hasLang(lang string) bool {
+	for _, resp := range ve.Responses {
+		if resp.Lang == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// newVocabularyFilter creates the filter from options of the history subcommand
+func newVocabularyFilter(opts historyFilterOptions, now time.Time) (*vocabularyFilter, error) {
+	f := &vocabularyFilter{lang: opts.Lang}
+	var err error
+	if opts.Since != "" {
+		if f.since, err = parseHistoryTime(opts.Since, now, false); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Until != "" {
+		if f.until, err = parseHistoryTime(opts.Until, now, true); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// parseHistoryTime parses the date, e.g. 2006-01-02, or the period ago, e.g. 7d or 12h, into the time.
+// If the end is set, the date means the end of the day
+func parseHistoryTime(s string, now time.Time, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, errors.Errorf("wrong time %s, use the date, e.g. 2006-01-02, or the period ago, e.g. 7d or 12h", s)
+}
+
+// recordVocabulary adds requests looked up in this run to the vocabulary
+func (lu *Lu) recordVocabulary() error {
+	if lu.opts.NoVocabulary || lu.opts.VocabularyFile == "" || len(lu.history) == 0 {
+		return nil
+	}
+	now := time.Now()
+	return updateVocabulary(lu.opts.VocabularyFile, func(v *vocabulary) bool {
+		for _, e := range lu.history {
+			v.add(e, now)
+		}
+		return true
+	})
+}
+
+// runHistoryCommand runs the history subcommand, e.g. "history list"
+func runHistoryCommand(w io.Writer, opts options, now time.Time) error {
+	v, err := loadVocabulary(opts.VocabularyFile)
+	if err != nil {
+		return err
+	}
+
+	h := opts.History
+	switch opts.command {
+	case "history list":
+		f, err := newVocabularyFilter(h.List.historyFilterOptions, now)
+		if err != nil {
+			return err
+		}
+		return listVocabulary(w, v.find(f))
+	case "history search":
+		f, err := newVocabularyFilter(h.Search.historyFilterOptions, now)
+		if err != nil {
+			return err
+		}
+		f.query = h.Search.Args.Query
+		return listVocabulary(w, v.find(f))
+	case "history delete":
+		f, err := newVocabularyFilter(h.Delete.historyFilterOptions, now)
+		if err != nil {
+			return err
+		}
+		f.requests = h.Delete.Args.Requests
+		if len(f.requests) == 0 && !h.Delete.All {
+			return errors.New("requests to delete must be specified, use --all to delete all requests matching filters")
+		}
+		// the vocabulary is read again under the lock, so requests recorded meanwhile are kept
+		n := 0
+		err = updateVocabulary(opts.VocabularyFile, func(v *vocabulary) bool {
+			n = v.remove(f)
+			return n > 0
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Deleted %d requests\n", n)
+		return nil
+	case "history export":
+		f, err := newVocabularyFilter(h.Export.historyFilterOptions, now)
+		if err != nil {
+			return err
+		}
+		return exportVocabulary(w, opts, v.find(f))
+	}
+	return errors.Errorf("unknown command %s", opts.command)
+}
+
+// listVocabulary prints entries as the table with translations to each language, lookups count and time
+func listVocabulary(w io.Writer, entries []*vocabularyEntry) error {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No requests found")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, ve := range entries {
+		var trs []string
+		for _, resp := range ve.Responses {
+			if resp.Found() {
+				trs = append(trs, resp.Lang+": "+strings.Join(resp.Translations, ", "))
+			}
+		}
+		if len(trs) == 0 {
+			trs = []string{"-"}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", ve.Request, ve.From, strings.Join(trs, "; "), ve.Lookups, ve.Updated.Local().Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+// exportVocabulary renders entries in the output format to the destination file or, if it isn't set, to w.
+// Entries are written in the order they were added, unless the sort option is set,
+// the number of lookups of the request is its count
+func exportVocabulary(w io.Writer, opts options, entries []*vocabularyEntry) error {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Added.Before(entries[j].Added) })
+	list := make([]*lookup.Entry, len(entries))
+	for i, ve := range entries {
+		e := *ve.Entry
+		e.Count = ve.Lookups
+		list[i] = &e
+	}
+	keys, err := parseSortKeys(opts.Sort)
+	if err != nil {
+		return err
+	}
+	if keys != nil {
+		newEntriesSorter(keys, opts.FromLang, opts.ToLangs).sort(list)
+	}
+
+	t, r, err := newFileOutput(opts.DstFileName, opts.Format, opts.Template, opts.TemplatesDir)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		r = &lookup.TemplateRenderer{Templater: t}
+	}
+
+	if opts.DstFileName == "" {
+		return r.Render(w, list)
+	}
+	var b bytes.Buffer
+	if err = r.Render(&b, list); err != nil {
+		return err
+	}
+	if err = writeFileAtomic(opts.DstFileName, b.Bytes()); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Exported %d requests to %s\n", len(list), opts.DstFileName)
+	return nil
+}
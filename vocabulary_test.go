@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dafanasev/lu/lookup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withVocabularyFile(t *testing.T, fn func(fname string)) {
+	dir, err := ioutil.TempDir("", "lu-vocabulary")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn(filepath.Join(dir, "lu", "vocabulary.json"))
+}
+
+// testVocabulary returns the vocabulary with dog looked up twice and cat once, a day after dog
+func testVocabulary(fname string, now time.Time) *vocabulary {
+	v := &vocabulary{file: fname}
+	v.add(&lookup.Entry{Request: "dog", From: "en", Line: 3, Count: 2, Responses: []*lookup.Response{
+		{Lang: "de", Status: lookup.StatusDictionary, Translations: []string{"Hund"}},
+	}}, now.AddDate(0, 0, -3))
+	v.add(&lookup.Entry{Request: "cat", From: "en", Responses: []*lookup.Response{
+		{Lang: "it", Status: lookup.StatusTranslation, Translations: []string{"gatto"}},
+	}}, now.AddDate(0, 0, -2))
+	v.add(&lookup.Entry{Request: " Dog", From: "en", Responses: []*lookup.Response{
+		{Lang: "de", Status: lookup.StatusDictionary, Translations: []string{"Hund", "Rüde"}},
+		{Lang: "it", Status: lookup.StatusNotFound},
+	}}, now.AddDate(0, 0, -1))
+	// entries without responses are not recorded
+	v.add(&lookup.Entry{Request: "pig", From: "en"}, now)
+	return v
+}
+
+func Test_vocabulary_add(t *testing.T) {
+	now := time.Now()
+	v := testVocabulary("", now)
+	require.Len(t, v.Entries, 2)
+
+	dog := v.Entries[0]
+	assert.Equal(t, "dog", dog.Request)
+	assert.Equal(t, 2, dog.Lookups)
+	assert.Equal(t, 0, dog.Line)
+	assert.Equal(t, 0, dog.Count)
+	assert.True(t, dog.Added.Equal(now.AddDate(0, 0, -3)))
+	assert.True(t, dog.Updated.Equal(now.AddDate(0, 0, -1)))
+	require.Len(t, dog.Responses, 2)
+	assert.Equal(t, []string{"Hund", "Rüde"}, dog.Responses[0].Translations)
+	assert.Equal(t, "it", dog.Responses[1].Lang)
+
+	// the same request translated from other language is the other one
+	v.add(&lookup.Entry{Request: "dog", From: "fr", Responses: []*lookup.Response{{Lang: "de"}}}, now)
+	assert.Len(t, v.Entries, 3)
+}
+
+func Test_vocabulary_save(t *testing.T) {
+	withVocabularyFile(t, func(fname string) {
+		v, err := loadVocabulary(fname)
+		require.NoError(t, err)
+		assert.Empty(t, v.Entries)
+
+		now := time.Now()
+		require.NoError(t, testVocabulary(fname, now).save())
+		v, err = loadVocabulary(fname)
+		require.NoError(t, err)
+		require.Len(t, v.Entries, 2)
+		assert.Equal(t, "dog", v.Entries[0].Request)
+		assert.Equal(t, 2, v.Entries[0].Lookups)
+		assert.Equal(t, []string{"gatto"}, v.Entries[1].Responses[0].Translations)
+		// requests of the loaded vocabulary are found by their keys
+		v.add(&lookup.Entry{Request: "Cat", From: "en", Responses: []*lookup.Response{{Lang: "it"}}}, now)
+		require.Len(t, v.Entries, 2)
+		assert.Equal(t, 2, v.Entries[1].Lookups)
+
+		require.NoError(t, ioutil.WriteFile(fname, []byte("{"), 0600))
+		_, err = loadVocabulary(fname)
+		assert.Error(t, err)
+	})
+}
+
+func Test_updateVocabulary(t *testing.T) {
+	withVocabularyFile(t, func(fname string) {
+		// concurrent runs don't lose each other's requests
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lu := &Lu{opts: options{VocabularyFile: fname}}
+				lu.history = []*lookup.Entry{{Request: "dog", From: "en", Responses: []*lookup.Response{{Lang: "de"}}}}
+				assert.NoError(t, lu.recordVocabulary())
+			}()
+		}
+		wg.Wait()
+		v, err := loadVocabulary(fname)
+		require.NoError(t, err)
+		require.Len(t, v.Entries, 1)
+		assert.Equal(t, 5, v.Entries[0].Lookups)
+		_, err = os.Stat(fname + vocabularyLockSuffix)
+		assert.True(t, os.IsNotExist(err))
+
+		// the lock left by the crashed run is removed
+		lock := fname + vocabularyLockSuffix
+		require.NoError(t, ioutil.WriteFile(lock, nil, 0600))
+		old := time.Now().Add(-2 * vocabularyLockStale)
+		require.NoError(t, os.Chtimes(lock, old, old))
+		require.NoError(t, updateVocabulary(fname, func(v *vocabulary) bool {
+			return v.remove(&vocabularyFilter{}) > 0
+		}))
+		v, err = loadVocabulary(fname)
+		require.NoError(t, err)
+		assert.Empty(t, v.Entries)
+	})
+}
+
+func Test_vocabulary_find(t *testing.T) {
+	now := time.Now()
+	v := testVocabulary("", now)
+
+	requests := func(entries []*vocabularyEntry) []string {
+		var reqs []string
+		for _, ve := range entries {
+			reqs = append(reqs, ve.Request)
+		}
+		return reqs
+	}
+	// the latest looked up go first
+	assert.Equal(t, []string{"dog", "cat"}, requests(v.find(&vocabularyFilter{})))
+	assert.Equal(t, []string{"cat"}, requests(v.find(&vocabularyFilter{query: "GAT"})))
+	assert.Equal(t, []string{"dog"}, requests(v.find(&vocabularyFilter{query: "do"})))
+	assert.Equal(t, []string{"dog"}, requests(v.find(&vocabularyFilter{lang: "de"})))
+	assert.Equal(t, []string{"dog", "cat"}, requests(v.find(&vocabularyFilter{lang: "en"})))
+	assert.Equal(t, []string{"cat"}, requests(v.find(&vocabularyFilter{requests: []string{"Cat"}})))
+	assert.Empty(t, v.find(&vocabularyFilter{since: now}))
+	assert.Equal(t, []string{"cat"}, requests(v.find(&vocabularyFilter{until: now.AddDate(0, 0, -1)})))
+}
+
+func Test_vocabulary_remove(t *testing.T) {
+	now := time.Now()
+	v := testVocabulary("", now)
+	assert.Equal(t, 0, v.remove(&vocabularyFilter{requests: []string{"pig"}}))
+	assert.Equal(t, 1, v.remove(&vocabularyFilter{requests: []string{"DOG"}}))
+	require.Len(t, v.Entries, 1)
+	assert.Equal(t, "cat", v.Entries[0].Request)
+
+	// the removed request is the new one when it is looked up again
+	v.add(&lookup.Entry{Request: "dog", From: "en", Responses: []*lookup.Response{{Lang: "de"}}}, now)
+	require.Len(t, v.Entries, 2)
+	assert.Equal(t, 1, v.Entries[1].Lookups)
+	assert.Equal(t, 2, v.remove(&vocabularyFilter{}))
+	assert.Empty(t, v.Entries)
+}
+
+func Test_parseHistoryTime(t *testing.T) {
+	now := time.Date(2020, 5, 10, 12, 0, 0, 0, time.Local)
+
+	tm, err := parseHistoryTime("2020-05-01", now, false)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 5, 1, 0, 0, 0, 0, time.Local), tm)
+	// the date includes the whole day when it is the end
+	tm, err = parseHistoryTime("2020-05-01", now, true)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 5, 2, 0, 0, 0, 0, time.Local), tm)
+
+	tm, err = parseHistoryTime("7d", now, false)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 5, 3, 12, 0, 0, 0, time.Local), tm)
+	tm, err = parseHistoryTime("2h", now, false)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 5, 10, 10, 0, 0, 0, time.Local), tm)
+
+	_, err = parseHistoryTime("last week", now, false)
+	assert.EqualError(t, err, "wrong time last week, use the date, e.g. 2006-01-02, or the period ago, e.g. 7d or 12h")
+}
+
+func Test_Lu_recordVocabulary(t *testing.T) {
+	withVocabularyFile(t, func(fname string) {
+		lu := &Lu{opts: options{VocabularyFile: fname, NoVocabulary: true}}
+		lu.history = []*lookup.Entry{{Request: "dog", From: "en", Responses: []*lookup.Response{{Lang: "de"}}}}
+		require.NoError(t, lu.recordVocabulary())
+		_, err := os.Stat(fname)
+		assert.True(t, os.IsNotExist(err))
+
+		lu.opts.NoVocabulary = false
+		require.NoError(t, lu.recordVocabulary())
+		require.NoError(t, lu.recordVocabulary())
+		v, err := loadVocabulary(fname)
+		require.NoError(t, err)
+		require.Len(t, v.Entries, 1)
+		assert.Equal(t, 2, v.Entries[0].Lookups)
+	})
+}
+
+func Test_runHistoryCommand(t *testing.T) {
+	withVocabularyFile(t, func(fname string) {
+		now := time.Now()
+		require.NoError(t, testVocabulary(fname, now).save())
+		opts := options{VocabularyFile: fname}
+		var w bytes.Buffer
+
+		opts.command = "history list"
+		require.NoError(t, runHistoryCommand(&w, opts, now))
+		assert.Contains(t, w.String(), "dog  en  de: Hund, Rüde  2")
+		assert.Contains(t, w.String(), "cat  en  it: gatto       1")
+
+		w.Reset()
+		opts.command = "history search"
+		opts.History.Search.Args.Query = "hund"
+		opts.History.Search.Since = "2d"
+		require.NoError(t, runHistoryCommand(&w, opts, now))
+		assert.Contains(t, w.String(), "dog")
+		assert.NotContains(t, w.String(), "cat")
+		opts.History.Search.Since = "yesterday"
+		assert.Error(t, runHistoryCommand(&w, opts, now))
+
+		w.Reset()
+		opts.command = "history export"
+		opts.Format = "csv"
+		require.NoError(t, runHistoryCommand(&w, opts, now))
+		// entries are exported in the order they were added, with the number of lookups as the count
+		assert.Equal(t, "request,from,lang,status,transcription,pos,translations,meta\n"+
+			"dog,en,de,dictionary,,,Hund; Rüde,\n"+
+			"dog,en,it,not_found,,,,\n"+
+			"cat,en,it,translation,,,gatto,\n", w.String())
+
+		w.Reset()
+		opts.Sort = "-count"
+		opts.Format = "jsonl"
+		opts.DstFileName = filepath.Join(filepath.Dir(fname), "export.jsonl")
+		require.NoError(t, runHistoryCommand(&w, opts, now))
+		assert.Equal(t, "Exported 2 requests to "+opts.DstFileName+"\n", w.String())
+		entries, err := (&jsonlDecoder{}).decodeList(bytes.NewReader(mustReadFile(t, opts.DstFileName)))
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, 2, entries[0].Count)
+
+		w.Reset()
+		opts.command = "history delete"
+		assert.Error(t, runHistoryCommand(&w, opts, now))
+		opts.History.Delete.Args.Requests = []string{"dog"}
+		require.NoError(t, runHistoryCommand(&w, opts, now))
+		assert.Equal(t, "Deleted 1 requests\n", w.String())
+		v, err := loadVocabulary(fname)
+		require.NoError(t, err)
+		require.Len(t, v.Entries, 1)
+		assert.Equal(t, "cat", v.Entries[0].Request)
+	})
+}
+
+func mustReadFile(t *testing.T, fname string) []byte {
+	b, err := ioutil.ReadFile(fname)
+	require.NoError(t, err)
+	return b
+}